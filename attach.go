@@ -0,0 +1,252 @@
+package clog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/nats-io/nats.go"
+)
+
+// AttachmentBucket is the JetStream Object Store bucket attachments and
+// oversized payloads are uploaded to
+const AttachmentBucket = "clog_attachments"
+
+// Longest message or user prompt kept in an event whose full payload was too
+// big for the NATS server and went to the object store instead
+const previewLength = 1024
+
+// Object store chunks are at most maxChunkSize, and leave chunkHeadroom
+// bytes of the server's max_payload for headers
+const (
+	maxChunkSize  = 128 * 1024
+	chunkHeadroom = 1024
+)
+
+// Attachment is a file uploaded to the attachments bucket with an event
+type Attachment struct {
+	Name   string `json:"name"`   // object name, for 'clog fetch'
+	Size   uint64 `json:"size"`   // bytes
+	Digest string `json:"digest"` // e.g. SHA-256=<base64url>
+}
+
+// attachmentStore returns the attachments bucket on nc's server, creating it
+// if needed and create is set
+func attachmentStore(ctx context.Context, nc *nats.Conn, create bool) (nats.ObjectStore, error) {
+	js, err := nc.JetStream(nats.Context(ctx))
+	if err != nil {
+		return nil, err
+	}
+	store, err := js.ObjectStore(AttachmentBucket)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if !create {
+			return nil, fmt.Errorf("attachment bucket %s: %w", AttachmentBucket, nats.ErrObjectNotFound)
+		}
+		store, err = js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: AttachmentBucket, Description: "clog event attachments"})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("attachment bucket %s: %w", AttachmentBucket, err)
+	}
+	return store, nil
+}
+
+// putAttachment uploads r to the attachments bucket as name, in chunks that
+// fit the server's max_payload
+func putAttachment(ctx context.Context, nc *nats.Conn, store nats.ObjectStore, name string, r io.Reader) (Attachment, error) {
+	chunk := int64(maxChunkSize)
+	if max := nc.MaxPayload() - chunkHeadroom; max > 0 && max < chunk {
+		chunk = max
+	}
+	meta := &nats.ObjectMeta{Name: name, Opts: &nats.ObjectMetaOptions{ChunkSize: uint32(chunk)}}
+	info, err := store.Put(meta, r, nats.Context(ctx))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("uploading attachment %s: %w", name, err)
+	}
+	return Attachment{Name: info.Name, Size: info.Size, Digest: info.Digest}, nil
+}
+
+// FetchAttachment writes the named object from the attachments bucket to w,
+// checked against the digest recorded at upload. A missing object or bucket
+// is nats.ErrObjectNotFound.
+func FetchAttachment(ctx context.Context, nc *nats.Conn, name string, w io.Writer) (Attachment, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+	}
+	store, err := attachmentStore(ctx, nc, false)
+	if err != nil {
+		return Attachment{}, err
+	}
+	result, err := store.Get(name, nats.Context(ctx))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("attachment %s: %w", name, err)
+	}
+	defer result.Close()
+
+	if _, err := io.Copy(w, result); err != nil {
+		return Attachment{}, fmt.Errorf("attachment %s: %w", name, err)
+	}
+	info, err := result.Info()
+	if err != nil {
+		return Attachment{}, err
+	}
+	return Attachment{Name: info.Name, Size: info.Size, Digest: info.Digest}, nil
+}
+
+// AttachmentPublisher uploads the files named in an event's AttachPaths to
+// the attachments bucket, then publishes the event with the uploads listed
+// in its Attachments
+type AttachmentPublisher struct {
+	next Publisher
+	nc   *nats.Conn
+
+	// Rules, if set, are applied to each file before it is uploaded, the same
+	// way RedactPublisher applies them to the message. Files that are not
+	// UTF-8 text cannot be redacted and are refused.
+	Rules []RedactRule
+
+	// OnRedact, if set, is called with the number of matches per rule when
+	// anything was redacted from the file at path
+	OnRedact func(path string, counts map[string]int)
+}
+
+// NewAttachmentPublisher uploads attachments over nc, which may be nil when
+// there is no NATS connection, before publishing through next
+func NewAttachmentPublisher(next Publisher, nc *nats.Conn) *AttachmentPublisher {
+	return &AttachmentPublisher{next: next, nc: nc}
+}
+
+// Publish uploads the event's files, if any, and publishes it. Objects are
+// named <event id>/<file name>, so the event must have an ID; one is
+// assigned here if it has none.
+func (p *AttachmentPublisher) Publish(ctx context.Context, e Event) error {
+	if len(e.AttachPaths) == 0 {
+		return p.next.Publish(ctx, e)
+	}
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	for _, path := range e.AttachPaths {
+		if info, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%w: -attach %s: %v", ErrInvalidEvent, path, err)
+		} else if !info.Mode().IsRegular() {
+			return fmt.Errorf("%w: -attach %s is not a file", ErrInvalidEvent, path)
+		}
+	}
+	// Files are redacted before anything is uploaded, so a file that cannot
+	// be redacted stops the event rather than leaving other uploads behind
+	contents := make([][]byte, len(e.AttachPaths))
+	if len(p.Rules) > 0 {
+		for i, path := range e.AttachPaths {
+			data, counts, err := redactFile(path, p.Rules)
+			if err != nil {
+				return err
+			}
+			contents[i] = data
+			total := 0
+			for _, n := range counts {
+				total += n
+			}
+			if total > 0 {
+				e.Redactions += total
+				if p.OnRedact != nil {
+					p.OnRedact(path, counts)
+				}
+			}
+		}
+	}
+	if p.nc == nil {
+		return fmt.Errorf("%w: -attach needs the nats sink", ErrInvalidConfig)
+	}
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+	}
+	store, err := attachmentStore(ctx, p.nc, true)
+	if err != nil {
+		return err
+	}
+	for i, path := range e.AttachPaths {
+		name := e.ID + "/" + filepath.Base(path)
+		var attachment Attachment
+		if contents[i] != nil {
+			attachment, err = putAttachment(ctx, p.nc, store, name, bytes.NewReader(contents[i]))
+		} else {
+			f, openErr := os.Open(path)
+			if openErr != nil {
+				return fmt.Errorf("%w: -attach %s: %v", ErrInvalidEvent, path, openErr)
+			}
+			attachment, err = putAttachment(ctx, p.nc, store, name, f)
+			f.Close()
+		}
+		if err != nil {
+			return err
+		}
+		e.Attachments = append(e.Attachments, attachment)
+	}
+	e.AttachPaths = nil
+	return p.next.Publish(ctx, e)
+}
+
+// redactFile reads the file at path and applies rules to it, refusing files
+// that are not UTF-8 text since secrets in them cannot be found
+func redactFile(path string, rules []RedactRule) ([]byte, map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: -attach %s: %v", ErrInvalidEvent, path, err)
+	}
+	if !utf8.Valid(data) {
+		return nil, nil, fmt.Errorf("%w: -attach %s is not UTF-8 text, so it cannot be redacted; binary files are only attached with redact=off and no redact_rules", ErrInvalidEvent, path)
+	}
+	text, counts := Redact(string(data), rules)
+	return []byte(text), counts, nil
+}
+
+// offloadPayload uploads the event's full payload to the attachments bucket
+// as <event id>/payload.json and returns the event cut down to fit a NATS
+// message: previews of its message and user prompt, marked Truncated, with
+// the payload listed in its Attachments
+func offloadPayload(ctx context.Context, nc *nats.Conn, e Event) (Event, error) {
+	data, err := json.Marshal(e.Payload())
+	if err != nil {
+		return e, err
+	}
+	store, err := attachmentStore(ctx, nc, true)
+	if err != nil {
+		return e, err
+	}
+	attachment, err := putAttachment(ctx, nc, store, e.ID+"/payload.json", bytes.NewReader(data))
+	if err != nil {
+		return e, err
+	}
+
+	e.Message = preview(e.Message)
+	e.UserPrompt = preview(e.UserPrompt)
+	e.Truncated = true
+	e.Attachments = append(e.Attachments, attachment)
+	return e, nil
+}
+
+// preview cuts text to previewLength bytes without splitting a character
+func preview(text string) string {
+	if len(text) <= previewLength {
+		return text
+	}
+	cut := previewLength
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
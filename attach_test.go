@@ -0,0 +1,236 @@
+package clog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestAttachmentPublisher(t *testing.T) {
+	nc := connectJetStreamServer(t)
+	dir := t.TempDir()
+	plan := filepath.Join(dir, "plan.md")
+	os.WriteFile(plan, []byte("# Plan\n\n1. Add VAT\n"), 0o600)
+	diff := filepath.Join(dir, "change.diff")
+	os.WriteFile(diff, bytes.Repeat([]byte("+ line\n"), 50000), 0o600)
+
+	var published Event
+	p := NewAttachmentPublisher(publisherFunc(func(_ context.Context, e Event) error {
+		published = e
+		return nil
+	}), nc)
+	event := Event{ID: "evt-1", Type: "task", State: "in_progress", Message: "Planning", AttachPaths: []string{plan, diff}}
+	if err := p.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if len(published.AttachPaths) != 0 || len(published.Attachments) != 2 {
+		t.Fatalf("published %+v", published)
+	}
+	for i, path := range []string{plan, diff} {
+		attachment := published.Attachments[i]
+		want, _ := os.ReadFile(path)
+		if attachment.Name != "evt-1/"+filepath.Base(path) || attachment.Size != uint64(len(want)) || !strings.HasPrefix(attachment.Digest, "SHA-256=") {
+			t.Errorf("attachment %d = %+v", i, attachment)
+		}
+
+		var got bytes.Buffer
+		fetched, err := FetchAttachment(context.Background(), nc, attachment.Name, &got)
+		if err != nil {
+			t.Fatalf("FetchAttachment() error = %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), want) || fetched != attachment {
+			t.Errorf("FetchAttachment() = %+v with %d bytes, want %+v", fetched, got.Len(), attachment)
+		}
+	}
+
+	if _, err := FetchAttachment(context.Background(), nc, "evt-1/missing", &bytes.Buffer{}); !errors.Is(err, nats.ErrObjectNotFound) {
+		t.Errorf("FetchAttachment(missing) error = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestAttachmentPublisherErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(file, []byte("notes"), 0o600)
+	next := publisherFunc(func(context.Context, Event) error {
+		t.Error("event published despite the error")
+		return nil
+	})
+
+	tests := []struct {
+		name    string
+		nc      *nats.Conn
+		paths   []string
+		wantErr error
+	}{
+		{name: "missing file", nc: connectJetStreamServer(t), paths: []string{file + ".missing"}, wantErr: ErrInvalidEvent},
+		{name: "directory", nc: connectJetStreamServer(t), paths: []string{filepath.Dir(file)}, wantErr: ErrInvalidEvent},
+		{name: "no nats connection", paths: []string{file}, wantErr: ErrInvalidConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewAttachmentPublisher(next, tt.nc)
+			err := p.Publish(context.Background(), Event{Type: "progress", Message: "m", AttachPaths: tt.paths})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Publish() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := FetchAttachment(context.Background(), connectJetStreamServer(t), "evt-1/notes.txt", &bytes.Buffer{}); !errors.Is(err, nats.ErrObjectNotFound) {
+		t.Errorf("FetchAttachment() without a bucket error = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestAttachmentPublisherRedacts(t *testing.T) {
+	nc := connectJetStreamServer(t)
+	dir := t.TempDir()
+	token := "ghp_" + strings.Repeat("a", 36)
+	notes := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notes, []byte("export GITHUB_TOKEN="+token+"\n"), 0o600)
+	binary := filepath.Join(dir, "dump.bin")
+	os.WriteFile(binary, []byte{0xff, 0xfe, 'g', 'h', 'p'}, 0o600)
+
+	var published Event
+	var redacted map[string]int
+	p := NewAttachmentPublisher(publisherFunc(func(_ context.Context, e Event) error {
+		published = e
+		return nil
+	}), nc)
+	p.Rules = BuiltinRedactRules
+	p.OnRedact = func(path string, counts map[string]int) {
+		if path != notes {
+			t.Errorf("OnRedact path = %q, want %q", path, notes)
+		}
+		redacted = counts
+	}
+
+	event := Event{ID: "evt-1", Type: "progress", Message: "m", AttachPaths: []string{notes}}
+	if err := p.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	var got bytes.Buffer
+	if _, err := FetchAttachment(context.Background(), nc, "evt-1/notes.txt", &got); err != nil {
+		t.Fatalf("FetchAttachment() error = %v", err)
+	}
+	if want := "export GITHUB_TOKEN=[REDACTED:github_token]\n"; got.String() != want {
+		t.Errorf("uploaded %q, want %q", got.String(), want)
+	}
+	if published.Redactions != 1 || redacted["github_token"] != 1 {
+		t.Errorf("Redactions = %d, OnRedact counts = %v, want 1 github_token", published.Redactions, redacted)
+	}
+
+	// A file that cannot be redacted is refused before anything is uploaded
+	event = Event{ID: "evt-2", Type: "progress", Message: "m", AttachPaths: []string{notes, binary}}
+	if err := p.Publish(context.Background(), event); !errors.Is(err, ErrInvalidEvent) || !strings.Contains(err.Error(), "cannot be redacted") {
+		t.Errorf("Publish(binary) error = %v, want ErrInvalidEvent", err)
+	}
+	if _, err := FetchAttachment(context.Background(), nc, "evt-2/notes.txt", &bytes.Buffer{}); !errors.Is(err, nats.ErrObjectNotFound) {
+		t.Errorf("FetchAttachment() after a refused event error = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestNATSPublisherOffload(t *testing.T) {
+	nc := startTestServer(t, &server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true, JetStream: true, StoreDir: t.TempDir(), MaxPayload: 8 * 1024})
+	sub, err := nc.SubscribeSync("claude.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prompt := strings.Repeat("Rewrite the invoice module — ", 1000)
+	event := Event{ID: "evt-big", Type: "task", State: "in_progress", Message: "Rewriting invoices", UserPrompt: prompt}
+	if err := NewNATSPublisher(nc, nil).Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	msg, err := sub.NextMsg(2 * time.Second)
+	if err != nil {
+		t.Fatalf("NextMsg() error = %v", err)
+	}
+	var got Message
+	if err := json.Unmarshal(msg.Data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Truncated || got.Message != "Rewriting invoices" || len(got.Attachments) != 1 || got.Attachments[0].Name != "evt-big/payload.json" {
+		t.Fatalf("published %+v", got)
+	}
+	if !utf8.ValidString(got.UserPrompt) || !strings.HasSuffix(got.UserPrompt, "…") || len(got.UserPrompt) > previewLength+len("…") {
+		t.Errorf("user_prompt preview is %d bytes: %q", len(got.UserPrompt), got.UserPrompt[len(got.UserPrompt)-10:])
+	}
+
+	var full bytes.Buffer
+	if _, err := FetchAttachment(context.Background(), nc, got.Attachments[0].Name, &full); err != nil {
+		t.Fatalf("FetchAttachment() error = %v", err)
+	}
+	var original Message
+	if err := json.Unmarshal(full.Bytes(), &original); err != nil {
+		t.Fatal(err)
+	}
+	if original.UserPrompt != prompt || original.Truncated {
+		t.Errorf("offloaded payload has a %d byte prompt, want %d", len(original.UserPrompt), len(prompt))
+	}
+}
+
+func TestNATSPublisherOffloadBoundary(t *testing.T) {
+	const maxPayload = 4096
+	nc := startTestServer(t, &server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true, JetStream: true, StoreDir: t.TempDir(), MaxPayload: maxPayload})
+	sub, err := nc.SubscribeSync("claude.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewNATSPublisher(nc, nil)
+
+	// sized returns an event whose message, headers included, is size bytes
+	sized := func(id string, size int) Event {
+		e := Event{ID: id, Type: "progress", Message: "x", Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+		data, headers, err := p.encode(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Message += strings.Repeat("x", size-messageSize(newMessage(e.Subject(), id, data, headers)))
+		return e
+	}
+
+	tests := []struct {
+		size          int
+		wantTruncated bool
+	}{
+		{size: maxPayload, wantTruncated: false},
+		{size: maxPayload + 1, wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.size), func(t *testing.T) {
+			e := sized(fmt.Sprintf("evt-%d", tt.size), tt.size)
+			// The data alone fits, so only counting the headers offloads it
+			if data, _, _ := p.encode(e); len(data) >= maxPayload {
+				t.Fatalf("data is %d bytes, want under %d", len(data), maxPayload)
+			}
+			if err := p.Publish(context.Background(), e); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			msg, err := sub.NextMsg(2 * time.Second)
+			if err != nil {
+				t.Fatalf("NextMsg() error = %v", err)
+			}
+			var got Message
+			if err := json.Unmarshal(msg.Data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", got.Truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
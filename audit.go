@@ -0,0 +1,253 @@
+package clog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+)
+
+// The audit log is rotated when it would grow past this size, unless
+// audit_log_max_size says otherwise
+const defaultAuditLogMaxSize = 10 << 20
+
+// Rotated audit logs kept alongside the current one (<path>.1 is the newest)
+const auditLogBackups = 3
+
+// Audit record results
+const (
+	AuditResultOK     = "ok"
+	AuditResultFailed = "failed"
+)
+
+// AuditRecord is one line of the audit log: an event and what happened when
+// it was published
+type AuditRecord struct {
+	Time    time.Time `json:"time"`
+	Subject string    `json:"subject"`
+	Message Message   `json:"message"`
+	Result  string    `json:"result"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// AuditLog is an append-only JSONL file with size-based rotation
+type AuditLog struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+}
+
+// NewAuditLog appends to path, rotating it once it would exceed maxSize bytes
+// (or the 10MB default when maxSize <= 0)
+func NewAuditLog(path string, maxSize int64) *AuditLog {
+	if maxSize <= 0 {
+		maxSize = defaultAuditLogMaxSize
+	}
+	return &AuditLog{path: path, maxSize: maxSize}
+}
+
+// AuditLogOptions returns the audit log configured by audit_log and
+// audit_log_max_size, or nil when auditing is off
+func AuditLogOptions(s Settings) (*AuditLog, error) {
+	path := s.Options["audit_log"].Value
+	if path == "" {
+		return nil, nil
+	}
+
+	var maxSize int64
+	if value := s.Options["audit_log_max_size"].Value; value != "" {
+		size, err := parseSize(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: audit_log_max_size '%s' is not a size such as 512K or 10M", ErrInvalidConfig, value)
+		}
+		maxSize = size
+	}
+	return NewAuditLog(path, maxSize), nil
+}
+
+// Path returns the current audit log file
+func (l *AuditLog) Path() string {
+	return l.path
+}
+
+// Append writes a record, rotating the log first if it would grow too big
+func (l *AuditLog) Append(r AuditRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	// Other clog processes append to the same log; without the lock two of
+	// them crossing the limit together would both rotate
+	unlock, err := lockFile(context.Background(), l.path+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if info, err := os.Stat(l.path); err == nil && info.Size() > 0 && info.Size()+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("rotating audit log: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotate shifts <path>.N to <path>.N+1, dropping the oldest, and moves the
+// current log to <path>.1
+func (l *AuditLog) rotate() error {
+	for i := auditLogBackups - 1; i >= 1; i-- {
+		err := os.Rename(rotatedPath(l.path, i), rotatedPath(l.path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(l.path, rotatedPath(l.path, 1))
+}
+
+// Records reads the audit log, including rotated files, oldest first
+func (l *AuditLog) Records() ([]AuditRecord, error) {
+	var records []AuditRecord
+	for i := auditLogBackups; i >= 0; i-- {
+		path := l.path
+		if i > 0 {
+			path = rotatedPath(l.path, i)
+		}
+
+		fileRecords, err := readAuditFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, fileRecords...)
+	}
+	return records, nil
+}
+
+// readAuditFile decodes one audit log file
+func readAuditFile(path string) ([]AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// rotatedPath returns the name of the nth rotated audit log
+func rotatedPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(value, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return n * multiplier, nil
+}
+
+// AuditPublisher records every event it publishes in an audit log
+type AuditPublisher struct {
+	next  Publisher
+	log   *AuditLog
+	scope string
+
+	// OnError, if set, is called when the audit record cannot be written.
+	// Audit failures never fail the publish itself.
+	OnError func(err error)
+}
+
+// NewAuditPublisher publishes through next and audits the result. Pass the
+// claims returned by Connect so session-scoped subjects are recorded as
+// published.
+func NewAuditPublisher(next Publisher, log *AuditLog, claims *jwt.UserClaims) *AuditPublisher {
+	return &AuditPublisher{next: next, log: log, scope: SessionScope(claims)}
+}
+
+// Publish publishes the event, then appends an audit record with the result
+func (p *AuditPublisher) Publish(ctx context.Context, e Event) error {
+	// The audit record shows the exact timestamp that was published
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	err := p.next.Publish(ctx, e)
+
+	scoped, subject, scopeErr := applyScope(e, p.scope)
+	if scopeErr == nil {
+		e = scoped
+	}
+	record := AuditRecord{
+		Time:    time.Now().UTC(),
+		Subject: subject,
+		Message: e.Payload(),
+		Result:  AuditResultOK,
+	}
+	if err != nil {
+		record.Result = AuditResultFailed
+		record.Error = err.Error()
+	}
+
+	if auditErr := p.log.Append(record); auditErr != nil && p.OnError != nil {
+		p.OnError(auditErr)
+	}
+	return err
+}
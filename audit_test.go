@@ -0,0 +1,210 @@
+package clog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+)
+
+func TestAuditLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "clog.jsonl")
+	log := NewAuditLog(path, 400)
+
+	for i := 0; i < 20; i++ {
+		record := AuditRecord{
+			Time:    time.Now().UTC(),
+			Subject: "claude.progress.update",
+			Message: Message{Event: "claude.progress.update", Message: "step " + string(rune('a'+i))},
+			Result:  AuditResultOK,
+		}
+		if err := log.Append(record); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".3"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("os.Stat(%s) error = %v", p, err)
+		}
+		if info.Size() > 400 {
+			t.Errorf("%s is %d bytes, want <= 400", p, info.Size())
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("%s mode = %v, want 0600", p, info.Mode().Perm())
+		}
+	}
+	if _, err := os.Stat(path + ".4"); !os.IsNotExist(err) {
+		t.Errorf("%s.4 should not exist: %v", path, err)
+	}
+
+	records, err := log.Records()
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if len(records) == 0 || records[len(records)-1].Message.Message != "step t" {
+		t.Fatalf("Records() = %+v, want newest last", records)
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].Message.Message <= records[i-1].Message.Message {
+			t.Errorf("Records() out of order at %d: %q after %q", i, records[i].Message.Message, records[i-1].Message.Message)
+		}
+	}
+}
+
+func TestAuditLogConcurrentRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clog.jsonl")
+	record := AuditRecord{Time: time.Now().UTC(), Subject: "claude.progress.update", Message: Message{Event: "claude.progress.update", Message: "step"}, Result: AuditResultOK}
+	data, _ := json.Marshal(record)
+	size := int64(len(data) + 1)
+
+	// Each writer has its own AuditLog, as separate clog processes do. Two
+	// records fit per file, so six fill three files and none may be lost.
+	const writers = 6
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := NewAuditLog(path, 2*size).Append(record); err != nil {
+				t.Errorf("Append() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	records, err := NewAuditLog(path, 2*size).Records()
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if len(records) != writers {
+		t.Errorf("Records() = %d records, want %d", len(records), writers)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+func TestAuditPublisher(t *testing.T) {
+	errDown := errors.New("sink down")
+	tests := []struct {
+		name        string
+		next        Publisher
+		claims      *jwt.UserClaims
+		event       Event
+		wantResult  string
+		wantSubject string
+		wantSession string
+	}{
+		{
+			name:        "published",
+			next:        publisherFunc(func(context.Context, Event) error { return nil }),
+			event:       Event{Type: "task", State: "completed", Message: "Done", SessionID: "s1"},
+			wantResult:  AuditResultOK,
+			wantSubject: "claude.tasks.completed",
+			wantSession: "s1",
+		},
+		{
+			name:        "failed",
+			next:        publisherFunc(func(context.Context, Event) error { return errDown }),
+			event:       Event{Type: "progress", Message: "Halfway"},
+			wantResult:  AuditResultFailed,
+			wantSubject: "claude.progress.update",
+		},
+		{
+			name:        "scoped credentials",
+			next:        publisherFunc(func(context.Context, Event) error { return nil }),
+			claims:      scopedClaims("agent-1"),
+			event:       Event{Type: "progress", Message: "Halfway"},
+			wantResult:  AuditResultOK,
+			wantSubject: "claude.progress.update.agent-1",
+			wantSession: "agent-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 0)
+			err := NewAuditPublisher(tt.next, log, tt.claims).Publish(context.Background(), tt.event)
+			if (tt.wantResult == AuditResultFailed) != errors.Is(err, errDown) {
+				t.Errorf("Publish() error = %v", err)
+			}
+
+			records, err := log.Records()
+			if err != nil || len(records) != 1 {
+				t.Fatalf("Records() = %v, %v, want one record", records, err)
+			}
+			r := records[0]
+			if r.Result != tt.wantResult || r.Subject != tt.wantSubject || r.Message.SessionID != tt.wantSession {
+				t.Errorf("record = %+v", r)
+			}
+			if (r.Error != "") != (tt.wantResult == AuditResultFailed) {
+				t.Errorf("record error = %q", r.Error)
+			}
+			if r.Message.Timestamp == "" || r.Message.Message != tt.event.Message {
+				t.Errorf("record message = %+v", r.Message)
+			}
+		})
+	}
+}
+
+func TestAuditPublisherWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	var auditErr error
+	p := NewAuditPublisher(publisherFunc(func(context.Context, Event) error { return nil }), NewAuditLog(filepath.Join(blocker, "audit.jsonl"), 0), nil)
+	p.OnError = func(err error) { auditErr = err }
+
+	if err := p.Publish(context.Background(), Event{Type: "progress", Message: "m"}); err != nil {
+		t.Errorf("Publish() error = %v, want audit failures not to fail the publish", err)
+	}
+	if auditErr == nil {
+		t.Error("OnError was not called for an unwritable audit log")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "512", want: 512},
+		{value: "64K", want: 64 << 10},
+		{value: "10MB", want: 10 << 20},
+		{value: "1g", want: 1 << 30},
+		{value: "0", wantErr: true},
+		{value: "lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSize(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// scopedClaims returns user claims as minted for a session
+func scopedClaims(session string) *jwt.UserClaims {
+	claims := jwt.NewUserClaims("UTEST")
+	claims.Tags.Add(sessionScopeTag)
+	claims.Pub.Allow.Add(ScopedSubjects(session)...)
+	return claims
+}
@@ -0,0 +1,165 @@
+package clog
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Output formats accepted in the format setting
+const (
+	// FormatJSON publishes the plain Message (the default)
+	FormatJSON = "json"
+	// FormatCloudEvents wraps the Message in a CloudEvents 1.0 JSON document
+	FormatCloudEvents = "cloudevents"
+	// FormatCloudEventsBinary publishes the plain Message with the CloudEvents
+	// attributes in NATS or HTTP headers
+	FormatCloudEventsBinary = "cloudevents-binary"
+)
+
+// Content types used by the output formats
+const (
+	contentTypeJSON        = "application/json"
+	contentTypeCloudEvents = "application/cloudevents+json"
+)
+
+// Format controls how events are encoded by publishers. The zero value
+// publishes the plain Message.
+type Format struct {
+	Mode   string // json|cloudevents|cloudevents-binary
+	Source string // CloudEvents source; defaults to /clog/<hostname>
+}
+
+// FormatOptions returns the output format configured by format and
+// cloudevents_source
+func FormatOptions(s Settings) (Format, error) {
+	f := Format{Mode: s.Options["format"].Value, Source: s.Options["cloudevents_source"].Value}
+	switch f.Mode {
+	case "":
+		f.Mode = FormatJSON
+	case FormatJSON, FormatCloudEvents, FormatCloudEventsBinary:
+	default:
+		return f, fmt.Errorf("%w: invalid format '%s'. Must be: json|cloudevents|cloudevents-binary", ErrInvalidConfig, f.Mode)
+	}
+	return f, nil
+}
+
+// CloudEvent is a CloudEvents 1.0 structured-mode JSON document
+type CloudEvent struct {
+	SpecVersion     string  `json:"specversion"`
+	ID              string  `json:"id"`
+	Source          string  `json:"source"`
+	Type            string  `json:"type"`
+	Time            string  `json:"time"`
+	Subject         string  `json:"subject,omitempty"`
+	Sequence        string  `json:"sequence,omitempty"` // sequence extension
+	DataContentType string  `json:"datacontenttype"`
+	Data            Message `json:"data"`
+}
+
+// CloudEvent wraps the event's Message as a CloudEvent. The type is the
+// event's subject, the CloudEvents subject is the session, and the session
+// sequence number, if any, is carried by the sequence extension.
+func (e Event) CloudEvent(source string) CloudEvent {
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	if source == "" {
+		source = defaultCloudEventsSource()
+	}
+
+	ce := CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              e.ID,
+		Source:          source,
+		Type:            e.Subject(),
+		Time:            e.Timestamp.UTC().Format(time.RFC3339Nano),
+		Subject:         e.SessionID,
+		DataContentType: contentTypeJSON,
+		Data:            e.Payload(),
+	}
+	if e.Seq != 0 {
+		ce.Sequence = strconv.FormatUint(e.Seq, 10)
+	}
+	return ce
+}
+
+// Headers returns the binary-mode attributes as ce- prefixed headers, with
+// datacontenttype carried as Content-Type
+func (c CloudEvent) Headers() map[string]string {
+	headers := map[string]string{
+		"ce-specversion": c.SpecVersion,
+		"ce-id":          c.ID,
+		"ce-source":      c.Source,
+		"ce-type":        c.Type,
+		"ce-time":        c.Time,
+		"Content-Type":   c.DataContentType,
+	}
+	if c.Subject != "" {
+		headers["ce-subject"] = c.Subject
+	}
+	if c.Sequence != "" {
+		headers["ce-sequence"] = c.Sequence
+	}
+	return headers
+}
+
+// encode returns the body and headers for an event. headers is nil for the
+// plain format.
+func (f Format) encode(e Event) ([]byte, map[string]string, error) {
+	var (
+		body    any
+		headers map[string]string
+	)
+	switch f.Mode {
+	case FormatCloudEvents:
+		body = e.CloudEvent(f.Source)
+		headers = map[string]string{"Content-Type": contentTypeCloudEvents}
+	case FormatCloudEventsBinary:
+		ce := e.CloudEvent(f.Source)
+		body, headers = ce.Data, ce.Headers()
+	default:
+		body = e.Payload()
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return data, headers, nil
+}
+
+// structured returns the format to use where there are no headers to carry
+// binary-mode attributes, such as JSONL files
+func (f Format) structured() Format {
+	if f.Mode == FormatCloudEventsBinary {
+		f.Mode = FormatCloudEvents
+	}
+	return f
+}
+
+// defaultCloudEventsSource identifies this machine as the event source
+func defaultCloudEventsSource() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return "/clog/" + host
+}
+
+// newEventID returns a random (version 4) UUID
+func newEventID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,155 @@
+package clog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestEventCloudEvent(t *testing.T) {
+	event := Event{
+		ID:        "evt-1",
+		Type:      "task",
+		State:     "in_progress",
+		Message:   "Adding VAT breakdown",
+		SessionID: "nye-api",
+		Timestamp: time.Date(2025, 10, 9, 14, 30, 0, 0, time.UTC),
+	}
+
+	ce := event.CloudEvent("/clog/test")
+	want := CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              "evt-1",
+		Source:          "/clog/test",
+		Type:            "claude.tasks.started",
+		Time:            "2025-10-09T14:30:00Z",
+		Subject:         "nye-api",
+		DataContentType: "application/json",
+		Data:            event.Payload(),
+	}
+	if !reflect.DeepEqual(ce, want) {
+		t.Errorf("CloudEvent() = %+v, want %+v", ce, want)
+	}
+
+	headers := ce.Headers()
+	if headers["ce-type"] != "claude.tasks.started" || headers["ce-subject"] != "nye-api" || headers["Content-Type"] != "application/json" {
+		t.Errorf("Headers() = %v", headers)
+	}
+
+	// Defaults for events without an ID or source
+	ce = Event{Type: "progress", Message: "m"}.CloudEvent("")
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(ce.ID) {
+		t.Errorf("ID = %q, want a UUID", ce.ID)
+	}
+	if ce.Source == "" || ce.Subject != "" {
+		t.Errorf("CloudEvent() = %+v, want default source and no subject", ce)
+	}
+	if _, ok := ce.Headers()["ce-subject"]; ok {
+		t.Error("Headers() should omit ce-subject without a session")
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{format: "", want: FormatJSON},
+		{format: "cloudevents", want: FormatCloudEvents},
+		{format: "cloudevents-binary", want: FormatCloudEventsBinary},
+		{format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			isolateSettings(t)
+			t.Setenv("CLOG_FORMAT", tt.format)
+			s, err := ResolveSettings("", Baked{})
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+
+			f, err := FormatOptions(s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("FormatOptions() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil || f.Mode != tt.want {
+				t.Errorf("FormatOptions() = %+v, %v, want mode %q", f, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNATSPublisherCloudEvents(t *testing.T) {
+	nc := connectTestServer(t)
+	sub, err := nc.SubscribeSync("claude.>")
+	if err != nil {
+		t.Fatalf("SubscribeSync() error = %v", err)
+	}
+	event := Event{ID: "evt-1", Type: "question", State: "blocked", Message: "Inclusive?", SessionID: "s1"}
+
+	p := NewNATSPublisher(nc, nil)
+	p.Format = Format{Mode: FormatCloudEvents, Source: "/clog/test"}
+	if err := p.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("NextMsg() error = %v", err)
+	}
+	var ce CloudEvent
+	if err := json.Unmarshal(msg.Data, &ce); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if ce.ID != "evt-1" || ce.Type != "claude.questions.waiting" || ce.Data.Message != "Inclusive?" {
+		t.Errorf("structured event = %+v", ce)
+	}
+	if got := msg.Header.Get("Content-Type"); got != "application/cloudevents+json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	p.Format.Mode = FormatCloudEventsBinary
+	if err := p.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	msg, err = sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("NextMsg() error = %v", err)
+	}
+	var data Message
+	if err := json.Unmarshal(msg.Data, &data); err != nil || data.Message != "Inclusive?" {
+		t.Errorf("binary data = %s, %v", msg.Data, err)
+	}
+	for name, want := range map[string]string{"ce-specversion": "1.0", "ce-id": "evt-1", "ce-source": "/clog/test", "ce-type": "claude.questions.waiting", "ce-subject": "s1"} {
+		if got := msg.Header.Get(name); got != want {
+			t.Errorf("header %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestHTTPPublisherCloudEventsBinary(t *testing.T) {
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPublisher(srv.URL, nil)
+	p.Format = Format{Mode: FormatCloudEventsBinary, Source: "/clog/test"}
+	if err := p.Publish(context.Background(), Event{ID: "evt-1", Type: "progress", Message: "m"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if headers.Get("ce-id") != "evt-1" || headers.Get("Idempotency-Key") != "evt-1" || headers.Get("ce-type") != "claude.progress.update" || headers.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", headers)
+	}
+}
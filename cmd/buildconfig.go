@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/davedotdev/clog"
+)
+
+// bakedConfig is an optional base64-encoded JSON blob injected at build time
+// with -ldflags "-X main.bakedConfig=..." (see 'clog build-config'). When set,
+// it replaces the default* and reminder* values below.
+var bakedConfig = ""
+
+// Sealed baked secrets and their key source (see 'build-config -key-file')
+var (
+	bakedSealed    = ""
+	bakedKeySource = ""
+)
+
+// bakedSettings is the build-time configuration carried by bakedConfig
+type bakedSettings struct {
+	URL       string   `json:"url"`
+	AuthType  string   `json:"auth_type"`
+	Username  string   `json:"username,omitempty"`
+	Password  string   `json:"password,omitempty"`
+	Token     string   `json:"token,omitempty"`
+	NKey      string   `json:"nkey,omitempty"`
+	JWT       string   `json:"jwt,omitempty"`
+	Seed      string   `json:"seed,omitempty"`
+	Sealed    string   `json:"sealed,omitempty"`
+	KeySource string   `json:"key_source,omitempty"`
+	Reminders []string `json:"reminders,omitempty"`
+}
+
+// applyBakedConfig decodes bakedConfig into the baked-in defaults
+func applyBakedConfig() error {
+	if bakedConfig == "" {
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(bakedConfig)
+	if err != nil {
+		return fmt.Errorf("baked configuration is corrupt: %w", err)
+	}
+
+	var b bakedSettings
+	if err := json.Unmarshal(data, &b); err != nil {
+		return fmt.Errorf("baked configuration is corrupt: %w", err)
+	}
+
+	defaultNATSURL = b.URL
+	defaultAuthType = b.AuthType
+	defaultUsername = b.Username
+	defaultPassword = b.Password
+	defaultToken = b.Token
+	defaultNKey = b.NKey
+	defaultNATSJWT = b.JWT
+	defaultNATSSeed = b.Seed
+	bakedSealed = b.Sealed
+	bakedKeySource = b.KeySource
+
+	reminders := append(b.Reminders, "", "", "")
+	reminder1, reminder2, reminder3 = reminders[0], reminders[1], reminders[2]
+	return nil
+}
+
+// encodeBakedConfig produces the bakedConfig value for a configuration
+func encodeBakedConfig(b bakedSettings) (string, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// runBuildConfig prints the -ldflags needed to bake a configuration into a
+// clog binary, so builds never modify the source tree. Each flag defaults to
+// a CLOG_BUILD_* environment variable so secrets need not appear in argv.
+func runBuildConfig(args []string) int {
+	env := func(name, fallback string) string {
+		if value := os.Getenv("CLOG_BUILD_" + name); value != "" {
+			return value
+		}
+		return fallback
+	}
+
+	fs := flag.NewFlagSet("build-config", flag.ContinueOnError)
+	urlFlag := fs.String("url", env("URL", "nats://localhost:4222"), "NATS URL")
+	authFlag := fs.String("auth", env("AUTH", "none"), "Auth type: none|userpass|token|nkey|decentralized")
+	usernameFlag := fs.String("username", env("USERNAME", ""), "Username (userpass)")
+	passwordFlag := fs.String("password", env("PASSWORD", ""), "Password (userpass)")
+	tokenFlag := fs.String("token", env("TOKEN", ""), "Token (token)")
+	nkeyFlag := fs.String("nkey", env("NKEY", ""), "NKey seed (nkey)")
+	jwtFlag := fs.String("jwt", env("JWT", ""), "User JWT (decentralized)")
+	seedFlag := fs.String("seed", env("SEED", ""), "User seed (decentralized)")
+	credsFlag := fs.String("creds", env("CREDS", ""), "Creds file to extract the JWT and seed from (decentralized)")
+	keyFileFlag := fs.String("key-file", env("KEY_FILE", ""), "Encrypt secrets with this key file (created if missing), or 'machine' to bind them to this machine")
+	reminder1Flag := fs.String("reminder1", env("REMINDER1", ""), "Custom reminder 1")
+	reminder2Flag := fs.String("reminder2", env("REMINDER2", ""), "Custom reminder 2")
+	reminder3Flag := fs.String("reminder3", env("REMINDER3", ""), "Custom reminder 3")
+	if err := fs.Parse(args); err != nil {
+		return exitInvalidArgs
+	}
+
+	b := bakedSettings{
+		URL:      *urlFlag,
+		AuthType: *authFlag,
+		Username: *usernameFlag,
+		Password: *passwordFlag,
+		Token:    *tokenFlag,
+		NKey:     *nkeyFlag,
+		JWT:      *jwtFlag,
+		Seed:     *seedFlag,
+	}
+	for _, reminder := range []string{*reminder1Flag, *reminder2Flag, *reminder3Flag} {
+		if reminder != "" {
+			b.Reminders = append(b.Reminders, reminder)
+		}
+	}
+
+	if *credsFlag != "" {
+		jwt, seed, err := clog.ReadCredsFile(*credsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "400 Bad Request: %v\n", err)
+			return exitInvalidArgs
+		}
+		b.AuthType, b.JWT, b.Seed = "decentralized", jwt, seed
+	}
+
+	if err := validateBakedSettings(b); err != nil {
+		fmt.Fprintf(os.Stderr, "400 Bad Request: %v\n", err)
+		return exitInvalidArgs
+	}
+
+	if *keyFileFlag != "" {
+		if err := sealBakedSettings(&b, *keyFileFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "500 Internal Server Error: %v\n", err)
+			return exitInvalidArgs
+		}
+	}
+
+	blob, err := encodeBakedConfig(b)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "500 Internal Server Error: %v\n", err)
+		return exitInvalidArgs
+	}
+
+	fmt.Printf("-X main.bakedConfig=%s\n", blob)
+	return exitSuccess
+}
+
+// sealBakedSettings replaces the secret values with an encrypted blob that
+// only the given key file (or this machine) can open
+func sealBakedSettings(b *bakedSettings, keySource string) error {
+	if keySource != clog.KeySourceMachine {
+		abs, err := filepath.Abs(keySource)
+		if err != nil {
+			return err
+		}
+		keySource = abs
+	}
+
+	created, err := clog.EnsureKeyFile(keySource)
+	if err != nil {
+		return fmt.Errorf("creating key file: %w", err)
+	}
+	if created {
+		fmt.Fprintf(os.Stderr, "Created key file %s - copy it alongside the binary\n", keySource)
+	}
+
+	material, err := clog.ReadKeyMaterial(keySource)
+	if err != nil {
+		return err
+	}
+
+	secrets := map[string]string{
+		"password": b.Password,
+		"token":    b.Token,
+		"nkey":     b.NKey,
+		"jwt":      b.JWT,
+		"seed":     b.Seed,
+	}
+	sealed, err := clog.SealSecrets(secrets, material)
+	if err != nil {
+		return err
+	}
+
+	b.Password, b.Token, b.NKey, b.JWT, b.Seed = "", "", "", "", ""
+	b.Sealed, b.KeySource = sealed, keySource
+	return nil
+}
+
+// baked returns the build-time settings for clog.ResolveSettings
+func baked() clog.Baked {
+	return clog.Baked{
+		URL:       defaultNATSURL,
+		AuthType:  defaultAuthType,
+		Username:  defaultUsername,
+		Password:  defaultPassword,
+		Token:     defaultToken,
+		NKey:      defaultNKey,
+		JWT:       defaultNATSJWT,
+		Seed:      defaultNATSSeed,
+		Sealed:    bakedSealed,
+		KeySource: bakedKeySource,
+	}
+}
+
+// validateBakedSettings checks a build configuration the same way connectNATS
+// will check it at runtime, so broken credentials fail the build
+func validateBakedSettings(b bakedSettings) error {
+	return clog.Baked{
+		URL:      b.URL,
+		AuthType: b.AuthType,
+		Username: b.Username,
+		Password: b.Password,
+		Token:    b.Token,
+		NKey:     b.NKey,
+		JWT:      b.JWT,
+		Seed:     b.Seed,
+	}.Validate()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davedotdev/clog"
+)
+
+func TestApplyBakedConfig(t *testing.T) {
+	origConfig := bakedConfig
+	origURL, origAuthType, origToken := defaultNATSURL, defaultAuthType, defaultToken
+	origReminders := []string{reminder1, reminder2, reminder3}
+	defer func() {
+		bakedConfig = origConfig
+		defaultNATSURL, defaultAuthType, defaultToken = origURL, origAuthType, origToken
+		reminder1, reminder2, reminder3 = origReminders[0], origReminders[1], origReminders[2]
+	}()
+
+	blob, err := encodeBakedConfig(bakedSettings{
+		URL:       "nats://baked.example.com:4222",
+		AuthType:  "token",
+		Token:     "s3cr3t",
+		Reminders: []string{"Ask before deploying", "Run the tests"},
+	})
+	if err != nil {
+		t.Fatalf("encodeBakedConfig() error = %v", err)
+	}
+
+	bakedConfig = blob
+	if err := applyBakedConfig(); err != nil {
+		t.Fatalf("applyBakedConfig() error = %v", err)
+	}
+
+	if defaultNATSURL != "nats://baked.example.com:4222" || defaultAuthType != "token" || defaultToken != "s3cr3t" {
+		t.Errorf("defaults = %q %q %q", defaultNATSURL, defaultAuthType, defaultToken)
+	}
+	if reminder1 != "Ask before deploying" || reminder2 != "Run the tests" || reminder3 != "" {
+		t.Errorf("reminders = %q %q %q", reminder1, reminder2, reminder3)
+	}
+
+	bakedConfig = "not base64!"
+	if err := applyBakedConfig(); err == nil {
+		t.Error("applyBakedConfig() with corrupt blob should fail")
+	}
+}
+
+func TestEncodeBakedConfigDeterministic(t *testing.T) {
+	b := bakedSettings{URL: "nats://localhost:4222", AuthType: "userpass", Username: "u", Password: "p"}
+
+	first, err := encodeBakedConfig(b)
+	if err != nil {
+		t.Fatalf("encodeBakedConfig() error = %v", err)
+	}
+	second, _ := encodeBakedConfig(b)
+	if first != second {
+		t.Error("encodeBakedConfig() should be deterministic for reproducible builds")
+	}
+}
+
+func TestValidateBakedSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		baked   bakedSettings
+		wantErr bool
+	}{
+		{
+			name:  "no auth",
+			baked: bakedSettings{URL: "nats://localhost:4222", AuthType: "none"},
+		},
+		{
+			name:  "userpass",
+			baked: bakedSettings{URL: "nats://localhost:4222", AuthType: "userpass", Username: "u", Password: "p"},
+		},
+		{
+			name:    "userpass without password",
+			baked:   bakedSettings{URL: "nats://localhost:4222", AuthType: "userpass", Username: "u"},
+			wantErr: true,
+		},
+		{
+			name:    "bad nkey",
+			baked:   bakedSettings{URL: "nats://localhost:4222", AuthType: "nkey", NKey: "SUAKTEST"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown auth type",
+			baked:   bakedSettings{URL: "nats://localhost:4222", AuthType: "kerberos"},
+			wantErr: true,
+		},
+		{
+			name:    "missing url",
+			baked:   bakedSettings{AuthType: "none"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBakedSettings(tt.baked)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateBakedSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSealBakedSettings(t *testing.T) {
+	isolateSettings(t)
+	t.Setenv("CLOG_KEY_FILE", "")
+
+	origURL, origAuthType, origUsername, origPassword := defaultNATSURL, defaultAuthType, defaultUsername, defaultPassword
+	origSealed, origKeySource := bakedSealed, bakedKeySource
+	defer func() {
+		defaultNATSURL, defaultAuthType, defaultUsername, defaultPassword = origURL, origAuthType, origUsername, origPassword
+		bakedSealed, bakedKeySource = origSealed, origKeySource
+	}()
+
+	keyFile := filepath.Join(t.TempDir(), "clog.key")
+	b := bakedSettings{URL: "nats://127.0.0.1:1", AuthType: "userpass", Username: "u", Password: "hunter2"}
+	if err := sealBakedSettings(&b, keyFile); err != nil {
+		t.Fatalf("sealBakedSettings() error = %v", err)
+	}
+	if b.Password != "" || b.Sealed == "" || b.KeySource != keyFile {
+		t.Fatalf("sealed settings = %+v", b)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file not created with mode 0600: %v", err)
+	}
+
+	defaultNATSURL, defaultAuthType, defaultUsername, defaultPassword = b.URL, b.AuthType, b.Username, b.Password
+	bakedSealed, bakedKeySource = b.Sealed, b.KeySource
+
+	// A copied binary without its key file fails with a credential error
+	t.Setenv("CLOG_KEY_FILE", filepath.Join(t.TempDir(), "missing.key"))
+	_, _, err := connectNATS("")
+	if !errors.Is(err, clog.ErrInvalidCredentials) || !strings.Contains(err.Error(), "CLOG_KEY_FILE") {
+		t.Errorf("connectNATS() error = %v, want ErrInvalidCredentials naming CLOG_KEY_FILE", err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/davedotdev/clog"
+)
+
+// eventCommand is a shorthand subcommand, such as 'clog task done', that
+// publishes one kind of event without -type and -state
+type eventCommand struct {
+	name      string
+	aliases   []string
+	eventType string
+	summary   string
+	usage     string // arguments after the command, for help
+	example   string
+
+	actions []eventAction // required first argument, if any
+	state   string        // state when there are no actions
+}
+
+// eventAction is the word after a command that picks the state, such as
+// 'start' in 'clog task start'
+type eventAction struct {
+	name    string
+	aliases []string
+	state   string
+	message string // default message, for actions that need none
+}
+
+// eventCommands is the shorthand grammar. Every action maps to a state that
+// is valid for the command's event type.
+var eventCommands = []eventCommand{
+	{
+		name:      "task",
+		aliases:   []string{"t"},
+		eventType: "task",
+		summary:   "Log a task changing state.",
+		usage:     `<action> ["message"]`,
+		example:   `clog task start "Adding VAT breakdown" -prompt="Add VAT breakdown to invoice API" -task-num=3/15`,
+		actions: []eventAction{
+			{name: "start", aliases: []string{"s", "begin"}, state: "in_progress"},
+			{name: "done", aliases: []string{"d", "complete"}, state: "completed", message: "Task completed"},
+			{name: "block", aliases: []string{"b", "blocked"}, state: "blocked", message: "Task blocked"},
+			{name: "pending", aliases: []string{"p", "todo"}, state: "pending"},
+		},
+	},
+	{
+		name:      "ask",
+		aliases:   []string{"q", "question"},
+		eventType: "question",
+		summary:   "Log a question you are waiting on the user to answer. Log it before asking.",
+		usage:     `"question"`,
+		example:   `clog ask "Should VAT be inclusive or exclusive?"`,
+		state:     "blocked",
+	},
+	{
+		name:      "progress",
+		aliases:   []string{"p"},
+		eventType: "progress",
+		summary:   "Report progress on multi-step work. A leading N/M also sets -task-num.",
+		usage:     `[N/M] ["message"]`,
+		example:   `clog progress 5/10 "tests passing"`,
+	},
+	{
+		name:      "session",
+		aliases:   []string{"s"},
+		eventType: "session",
+		summary:   "Log a work session starting or ending.",
+		usage:     `<action> ["message"]`,
+		example:   `clog session start "API improvements design doc"`,
+		actions: []eventAction{
+			{name: "start", aliases: []string{"s", "begin"}, state: ""},
+			{name: "end", aliases: []string{"e", "done", "stop"}, state: "completed", message: "Session ended"},
+		},
+	},
+}
+
+// A leading progress count such as 5/10
+var progressCount = regexp.MustCompile(`^\d+/\d+$`)
+
+// findEventCommand returns the shorthand command called name or one of its
+// aliases, or nil
+func findEventCommand(name string) *eventCommand {
+	for i := range eventCommands {
+		cmd := &eventCommands[i]
+		if cmd.name == name || slices.Contains(cmd.aliases, name) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// findAction returns the command's action called name or one of its aliases
+func (c *eventCommand) findAction(name string) *eventAction {
+	for i := range c.actions {
+		action := &c.actions[i]
+		if action.name == name || slices.Contains(action.aliases, name) {
+			return action
+		}
+	}
+	return nil
+}
+
+// runEventCommand parses and publishes a shorthand command such as
+// 'clog task start "msg" -session=x'. Flags may come before or after the
+// message; words after "--" are always part of the message.
+func runEventCommand(cmd *eventCommand, args []string) int {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	messageFlag := fs.String("message", "", "Message content instead of the positional message (string, @file, or - for stdin)")
+	promptFlag := fs.String("prompt", "", "User's EXACT, VERBATIM input, same as -user-prompt (string, @file, or - for stdin)")
+	fs.StringVar(promptFlag, "user-prompt", "", "User's EXACT, VERBATIM input")
+	taskNumFlag := fs.String("task-num", "", "Current task number (e.g., \"3/15\")")
+	sessionFlag := fs.String("session", "", "Session identifier (any string)")
+	idempotencyKeyFlag := fs.String("idempotency-key", "", "Message ID to reuse when retrying (optional)")
+	var attachFlag pathList
+	fs.Var(&attachFlag, "attach", "File to upload to the object store with the event (repeatable)")
+	contextFlag := fs.String("context", "", "NATS CLI context name")
+
+	words, err := parseInterspersed(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		printCommandHelp(os.Stdout, cmd, fs)
+		return exitSuccess
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "400 Bad Request: %v (see 'clog %s -h')\n", err, cmd.name)
+		return exitInvalidArgs
+	}
+
+	inputs := &inputReader{stdin: os.Stdin}
+	*messageFlag, err = inputs.read("message", *messageFlag)
+	if err == nil {
+		*promptFlag, err = inputs.read("prompt", *promptFlag)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "400 Bad Request: %v\n", err)
+		return exitInvalidArgs
+	}
+
+	event := clog.Event{
+		Type:       cmd.eventType,
+		State:      cmd.state,
+		UserPrompt: *promptFlag,
+		TaskNum:    *taskNumFlag,
+		SessionID:  *sessionFlag,
+		Timestamp:  time.Now(),
+		ID:         *idempotencyKeyFlag,
+
+		AttachPaths: attachFlag,
+	}
+
+	defaultMessage := ""
+	if len(cmd.actions) > 0 {
+		if len(words) == 0 {
+			fmt.Fprintf(os.Stderr, "400 Bad Request: 'clog %s' needs an action: %s (see 'clog %s -h')\n", cmd.name, actionNames(cmd), cmd.name)
+			return exitInvalidArgs
+		}
+		action := cmd.findAction(words[0])
+		if action == nil {
+			fmt.Fprintf(os.Stderr, "400 Bad Request: unknown action '%s' for 'clog %s'. Must be: %s\n", words[0], cmd.name, actionNames(cmd))
+			return exitInvalidArgs
+		}
+		event.State, defaultMessage = action.state, action.message
+		words = words[1:]
+	}
+	if cmd.eventType == "progress" && len(words) > 0 && progressCount.MatchString(words[0]) {
+		if event.TaskNum == "" {
+			event.TaskNum = words[0]
+		}
+		if len(words) == 1 {
+			defaultMessage = words[0]
+		}
+	}
+
+	event.Message = strings.Join(words, " ")
+	if *messageFlag != "" {
+		if event.Message != "" && event.Message != defaultMessage {
+			fmt.Fprintln(os.Stderr, "400 Bad Request: give the message either as an argument or with -message, not both")
+			return exitInvalidArgs
+		}
+		event.Message = *messageFlag
+	}
+	if event.Message == "" {
+		event.Message = defaultMessage
+	}
+	if event.Message == "" {
+		fmt.Fprintf(os.Stderr, "400 Bad Request: a message is required: clog %s %s\n", cmd.name, cmd.usage)
+		return exitInvalidArgs
+	}
+
+	return publishEvent(event, *contextFlag)
+}
+
+// parseInterspersed parses flags that may appear between positional
+// arguments, returning the positional arguments in order
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var words, rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return append(words, rest...), nil
+		}
+		words = append(words, args[0])
+		args = args[1:]
+	}
+}
+
+// printCommandHelp prints help for a shorthand command, generated from its
+// definition and flags
+func printCommandHelp(w io.Writer, cmd *eventCommand, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: clog %s %s [flags]\n\n%s\n", cmd.name, cmd.usage, cmd.summary)
+	if len(cmd.aliases) > 0 {
+		fmt.Fprintf(w, "Aliases: %s\n", strings.Join(cmd.aliases, ", "))
+	}
+
+	if len(cmd.actions) > 0 {
+		fmt.Fprintln(w, "\nActions:")
+		for _, action := range cmd.actions {
+			names := strings.Join(append([]string{action.name}, action.aliases...), ", ")
+			detail := clog.Subject(cmd.eventType, action.state)
+			if action.message != "" {
+				detail += fmt.Sprintf(`; message defaults to "%s"`, action.message)
+			}
+			fmt.Fprintf(w, "  %-22s %s\n", names, detail)
+		}
+	} else {
+		fmt.Fprintf(w, "\nPublishes to %s\n", clog.Subject(cmd.eventType, cmd.state))
+	}
+
+	fmt.Fprintln(w, "\nFlags:")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+	fmt.Fprintf(w, "\nExample:\n  %s\n", cmd.example)
+}
+
+// actionNames lists a command's actions for error messages
+func actionNames(cmd *eventCommand) string {
+	names := make([]string, 0, len(cmd.actions))
+	for _, action := range cmd.actions {
+		names = append(names, action.name)
+	}
+	return strings.Join(names, "|")
+}
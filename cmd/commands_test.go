@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/davedotdev/clog"
+)
+
+func TestEventCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		want     clog.Message
+	}{
+		{
+			name: "task start with flags after the message",
+			args: []string{"task", "start", "Adding VAT", "-prompt=Add VAT", "-task-num=3/15", "-session=s1"},
+			want: clog.Message{Event: "claude.tasks.started", State: "in_progress", Message: "Adding VAT", UserPrompt: "Add VAT", TaskNum: "3/15", SessionID: "s1"},
+		},
+		{
+			name: "task done with default message",
+			args: []string{"t", "d", "-session=s1"},
+			want: clog.Message{Event: "claude.tasks.completed", State: "completed", Message: "Task completed", SessionID: "s1"},
+		},
+		{
+			name: "task block",
+			args: []string{"task", "block", "Waiting", "on", "review"},
+			want: clog.Message{Event: "claude.tasks.blocked", State: "blocked", Message: "Waiting on review"},
+		},
+		{
+			name: "ask",
+			args: []string{"ask", "Inclusive or exclusive?"},
+			want: clog.Message{Event: "claude.questions.waiting", State: "blocked", Message: "Inclusive or exclusive?"},
+		},
+		{
+			name: "progress count only",
+			args: []string{"progress", "5/10"},
+			want: clog.Message{Event: "claude.progress.update", Message: "5/10", TaskNum: "5/10"},
+		},
+		{
+			name: "progress count and message",
+			args: []string{"p", "5/10", "tests passing"},
+			want: clog.Message{Event: "claude.progress.update", Message: "5/10 tests passing", TaskNum: "5/10"},
+		},
+		{
+			name: "session end",
+			args: []string{"session", "end"},
+			want: clog.Message{Event: "claude.session.completed", State: "completed", Message: "Session ended"},
+		},
+		{
+			name: "message after --",
+			args: []string{"progress", "--", "-5 degrees"},
+			want: clog.Message{Event: "claude.progress.update", Message: "-5 degrees"},
+		},
+		{
+			name: "-message flag",
+			args: []string{"session", "start", "-message=Kick-off"},
+			want: clog.Message{Event: "claude.session.started", Message: "Kick-off"},
+		},
+		{name: "missing action", args: []string{"task"}, wantCode: exitInvalidArgs},
+		{name: "unknown action", args: []string{"task", "finish", "x"}, wantCode: exitInvalidArgs},
+		{name: "missing message", args: []string{"task", "start"}, wantCode: exitInvalidArgs},
+		{name: "message twice", args: []string{"ask", "a", "-message=b"}, wantCode: exitInvalidArgs},
+		{name: "unknown flag", args: []string{"ask", "a", "-colour=red"}, wantCode: exitInvalidArgs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateSettings(t)
+			file := filepath.Join(t.TempDir(), "events.jsonl")
+			t.Setenv("CLOG_SINKS", "file:"+file)
+
+			cmd := findEventCommand(tt.args[0])
+			if cmd == nil {
+				t.Fatalf("findEventCommand(%q) = nil", tt.args[0])
+			}
+			if code := runEventCommand(cmd, tt.args[1:]); code != tt.wantCode {
+				t.Fatalf("runEventCommand() = %d, want %d", code, tt.wantCode)
+			}
+
+			data, _ := os.ReadFile(file)
+			if tt.wantCode != exitSuccess {
+				if len(data) != 0 {
+					t.Errorf("published %s, want nothing", data)
+				}
+				return
+			}
+			var got clog.Message
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("published %q: %v", data, err)
+			}
+			got.ID, got.Timestamp, got.Seq = "", "", 0
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("published %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventCommandStates(t *testing.T) {
+	// The grammar must only produce valid type/state combinations
+	for _, cmd := range eventCommands {
+		states := []string{cmd.state}
+		for _, action := range cmd.actions {
+			states = append(states, action.state)
+		}
+		for _, state := range states {
+			if state != "" && !slices.Contains(clog.ValidStates(cmd.eventType), state) {
+				t.Errorf("clog %s produces state %q, which is not valid for %s", cmd.name, state, cmd.eventType)
+			}
+		}
+	}
+}
+
+func TestPrintCommandHelp(t *testing.T) {
+	var out strings.Builder
+	printCommandHelp(&out, findEventCommand("task"), flag.NewFlagSet("task", flag.ContinueOnError))
+	for _, want := range []string{"Usage: clog task <action>", "done, d, complete", "claude.tasks.completed", "Example:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("help is missing %q:\n%s", want, out.String())
+		}
+	}
+}
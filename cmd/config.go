@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/davedotdev/clog"
+)
+
+// runConfig handles the 'clog config' subcommands
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, "400 Bad Request: usage: clog config show [-json] [-context=<name>]")
+		return exitInvalidArgs
+	}
+
+	fs := flag.NewFlagSet("config show", flag.ContinueOnError)
+	jsonFlag := fs.Bool("json", false, "Print the configuration as JSON")
+	contextFlag := fs.String("context", "", "NATS CLI context name")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitInvalidArgs
+	}
+
+	s, err := clog.ResolveSettings(*contextFlag, baked())
+	if err != nil {
+		status, code := connectionFailure(err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
+	}
+
+	if *jsonFlag {
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "500 Internal Server Error: Failed to marshal JSON: %v\n", err)
+			return exitInvalidArgs
+		}
+		fmt.Println(string(data))
+		return exitSuccess
+	}
+
+	printSettings(s)
+	fmt.Println()
+	fmt.Println("Precedence: env > context > config > baked (credentials are taken from one source only)")
+	return exitSuccess
+}
+
+// printSettings shows the effective configuration with secrets redacted
+func printSettings(s clog.Settings) {
+	config := s.ConfigPath
+	if !s.ConfigFound {
+		config += " (not found)"
+	}
+
+	fmt.Println("Configuration:")
+	fmt.Printf("  %-21s %s\n", "config", config)
+	if s.Context.Value != "" {
+		fmt.Printf("  %-21s %s %s\n", "context", s.Context, s.ContextPath)
+	}
+	if s.ProjectPath != "" {
+		fmt.Printf("  %-21s %s\n", "project", s.ProjectPath)
+	}
+	fmt.Printf("  %-21s %s\n", "url", s.URL)
+	fmt.Printf("  %-21s %s\n", "auth", s.AuthType)
+	for _, field := range clog.AuthFields[s.AuthType.Value] {
+		fmt.Printf("  %-21s %s\n", field, s.Auth[field])
+	}
+	for _, field := range clog.OptionFields {
+		if option, ok := s.Options[field]; ok {
+			fmt.Printf("  %-21s %s\n", field, option)
+		}
+	}
+}
+
+// bakedSummary describes the build-time auth type and server host for -v
+func bakedSummary() string {
+	authType := defaultAuthType
+	if authType == "" {
+		authType = "none"
+	}
+
+	host := defaultNATSURL
+	if u, err := url.Parse(defaultNATSURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return fmt.Sprintf("baked: auth=%s host=%s", authType, host)
+}
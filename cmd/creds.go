@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/davedotdev/clog"
+)
+
+// Default lifetime of minted credentials
+const defaultMintTTL = 24 * time.Hour
+
+// runCreds handles the 'clog creds' subcommands
+func runCreds(args []string) int {
+	if len(args) == 0 || args[0] != "mint" {
+		fmt.Fprintln(os.Stderr, "400 Bad Request: usage: clog creds mint -signing-key=<file|seed> -session=<id> [-account=<key>] [-ttl=24h] [-o=<file>]")
+		return exitInvalidArgs
+	}
+
+	fs := flag.NewFlagSet("creds mint", flag.ContinueOnError)
+	signingKeyFlag := fs.String("signing-key", os.Getenv("CLOG_SIGNING_KEY"), "Account signing key seed, or a file holding it (default: $CLOG_SIGNING_KEY)")
+	accountFlag := fs.String("account", "", "Account public key, when -signing-key is a signing key rather than the account key")
+	sessionFlag := fs.String("session", "", "Session the credentials may publish for")
+	ttlFlag := fs.Duration("ttl", defaultMintTTL, "Lifetime of the credentials")
+	nameFlag := fs.String("name", "", "User name in the JWT (default: clog-<session>)")
+	outFlag := fs.String("o", "", "Write the .creds file here instead of stdout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitInvalidArgs
+	}
+
+	name := *nameFlag
+	if name == "" {
+		name = "clog-" + *sessionFlag
+	}
+
+	creds, claims, err := clog.MintCreds(*signingKeyFlag, *accountFlag, *sessionFlag, name, *ttlFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "400 Bad Request: %v\n", err)
+		return exitInvalidArgs
+	}
+
+	if *outFlag == "" {
+		fmt.Print(string(creds))
+		return exitSuccess
+	}
+
+	if err := os.WriteFile(*outFlag, creds, 0o600); err != nil {
+		fmt.Fprintf(os.Stderr, "500 Internal Server Error: %v\n", err)
+		return exitInvalidArgs
+	}
+	fmt.Printf("Wrote %s (session %s, expires %s)\n", *outFlag, *sessionFlag, clog.ClaimsExpiry(claims).UTC().Format(time.RFC3339))
+	fmt.Printf("Use it with: NATS_CREDS=%s clog -session=%s ...\n", *outFlag, *sessionFlag)
+	return exitSuccess
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davedotdev/clog"
+	"github.com/nats-io/nats.go"
+)
+
+// Timeout for each network step of the doctor checks
+const doctorTimeout = 5 * time.Second
+
+// doctorSubject receives the probe sent by 'clog doctor -publish'. It is
+// outside claude.>, so subscribers and the CLOG stream never see it.
+const doctorSubject = "_clog.doctor"
+
+// serverInfo is the subset of the NATS INFO protocol line doctor inspects
+type serverInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// runDoctor prints the effective configuration and checks each step needed
+// to publish, stopping at the first failure
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	contextFlag := fs.String("context", "", "NATS CLI context name")
+	publishFlag := fs.Bool("publish", false, "Also publish a probe message to "+doctorSubject)
+	if err := fs.Parse(args); err != nil {
+		return exitInvalidArgs
+	}
+
+	fmt.Println("clog doctor")
+	fmt.Println()
+
+	s, err := clog.ResolveSettings(*contextFlag, baked())
+	if err != nil {
+		status, code := connectionFailure(err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
+	}
+	printSettings(s)
+
+	fmt.Println()
+	fmt.Println("Checks:")
+
+	claims, err := clog.UserClaims(s)
+	if err != nil {
+		err = clog.CredentialError(s.AuthType.Source+" "+s.AuthType.Value, err)
+		status, code := connectionFailure(err)
+		doctorCheck("FAIL", "jwt", err.Error())
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
+	}
+	if claims != nil {
+		for _, line := range clog.DescribeClaims(claims) {
+			doctorCheck("ok", "jwt", line)
+		}
+		if warning := clog.ExpiryReminder(claims, time.Now()); warning != "" {
+			doctorCheck("warn", "jwt", warning)
+		}
+	}
+
+	tlsCfg, err := clog.TLSConfig(s)
+	if err != nil {
+		status, code := connectionFailure(err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
+	}
+
+	for _, server := range strings.Split(s.URL.Value, ",") {
+		if code := checkServer(strings.TrimSpace(server), tlsCfg, s.Options["tls_first"].Value == "true"); code != exitSuccess {
+			return code
+		}
+	}
+
+	nc, _, err := connectNATS(*contextFlag)
+	if err != nil {
+		status, code := connectionFailure(err)
+		doctorCheck("FAIL", "auth", err.Error())
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
+	}
+	defer nc.Close()
+	doctorCheck("ok", "auth", fmt.Sprintf("%s accepted by %s", s.AuthType.Value, nc.ConnectedUrlRedacted()))
+
+	// Permissions are read from the user JWT rather than tested with real
+	// events, which subscribers would see
+	if claims == nil {
+		doctorCheck("skip", "publish", "permissions are not in the credentials; 'clog doctor -publish' sends a probe")
+	} else {
+		subjects := clog.Subjects()
+		if scope := clog.SessionScope(claims); scope != "" {
+			subjects = clog.ScopedSubjects(scope)
+		}
+		for _, subject := range subjects {
+			if !clog.CanPublish(claims, subject) {
+				doctorCheck("FAIL", "publish", subject+" is not allowed by the JWT")
+				fmt.Fprintf(os.Stderr, "403 Forbidden: publish to subject '%s' is not allowed by the JWT\n", subject)
+				return exitAuthError
+			}
+			doctorCheck("ok", "publish", subject+" (allowed by the JWT)")
+		}
+	}
+	switch {
+	case !*publishFlag:
+	case claims != nil && !clog.CanPublish(claims, doctorSubject):
+		doctorCheck("skip", "probe", doctorSubject+" is not allowed by the JWT")
+	default:
+		if err := probePublish(nc, doctorSubject); err != nil {
+			doctorCheck("FAIL", "probe", err.Error())
+			if clog.IsAuthRejection(err) {
+				fmt.Fprintf(os.Stderr, "403 Forbidden: %v\n", err)
+				return exitAuthError
+			}
+			fmt.Fprintf(os.Stderr, "503 Service Unavailable: %v\n", err)
+			return exitConnectionError
+		}
+		doctorCheck("ok", "probe", doctorSubject)
+	}
+
+	rtt, err := nc.RTT()
+	if err != nil {
+		doctorCheck("FAIL", "rtt", err.Error())
+		fmt.Fprintf(os.Stderr, "503 Service Unavailable: %v\n", err)
+		return exitConnectionError
+	}
+	doctorCheck("ok", "rtt", rtt.String())
+	doctorCheck("ok", "server", fmt.Sprintf("v%s (max_payload %d bytes)", nc.ConnectedServerVersion(), nc.MaxPayload()))
+
+	fmt.Println()
+	fmt.Println("200 OK")
+	return exitSuccess
+}
+
+// checkServer runs the DNS, TCP and TLS checks for one server URL
+func checkServer(server string, tlsCfg *tls.Config, tlsFirst bool) int {
+	u, err := url.Parse(server)
+	if err != nil || u.Hostname() == "" {
+		// nats.go also accepts bare host:port
+		u, err = url.Parse("nats://" + server)
+	}
+	if err != nil {
+		doctorCheck("FAIL", "url", fmt.Sprintf("%s: %v", server, err))
+		fmt.Fprintf(os.Stderr, "400 Bad Request: invalid NATS URL: %v\n", err)
+		return exitAuthError
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "4222"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return doctorNetworkFailure("dns", err)
+	}
+	doctorCheck("ok", "dns", fmt.Sprintf("%s -> %s", host, strings.Join(addrs, ", ")))
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), doctorTimeout)
+	if err != nil {
+		return doctorNetworkFailure("tcp", err)
+	}
+	defer conn.Close()
+	doctorCheck("ok", "tcp", fmt.Sprintf("%s (%s)", net.JoinHostPort(host, port), time.Since(start).Round(time.Microsecond)))
+
+	if u.Scheme == "ws" || u.Scheme == "wss" {
+		doctorCheck("skip", "tls", "websocket servers are checked by the auth step")
+		return exitSuccess
+	}
+
+	// Servers expecting a TLS handshake first send no INFO until it completes
+	if !tlsFirst {
+		info, err := readServerInfo(conn)
+		if err != nil {
+			return doctorNetworkFailure("info", err)
+		}
+		if !info.TLSRequired && u.Scheme != "tls" && tlsCfg == nil {
+			doctorCheck("skip", "tls", "not required by server")
+			return exitSuccess
+		}
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if tlsCfg != nil {
+		cfg = tlsCfg.Clone()
+	}
+	cfg.ServerName = host
+	tlsConn := tls.Client(conn, cfg)
+	_ = tlsConn.SetDeadline(time.Now().Add(doctorTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return doctorNetworkFailure("tls", err)
+	}
+	state := tlsConn.ConnectionState()
+	doctorCheck("ok", "tls", fmt.Sprintf("%s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite)))
+	return exitSuccess
+}
+
+// readServerInfo reads the INFO line a NATS server sends on connect
+func readServerInfo(conn net.Conn) (serverInfo, error) {
+	var info serverInfo
+
+	_ = conn.SetReadDeadline(time.Now().Add(doctorTimeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return info, fmt.Errorf("no INFO from server: %w", err)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	payload, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return info, fmt.Errorf("unexpected greeting from server: %q", line)
+	}
+	if err := json.Unmarshal([]byte(payload), &info); err != nil {
+		return info, fmt.Errorf("malformed INFO from server: %w", err)
+	}
+	return info, nil
+}
+
+// probePublish publishes a probe message and waits for the server to accept
+// or reject it
+func probePublish(nc *nats.Conn, subject string) error {
+	if err := nc.Publish(subject, []byte("clog doctor probe")); err != nil {
+		return fmt.Errorf("failed to publish to subject '%s': %w", subject, err)
+	}
+	if err := nc.FlushTimeout(doctorTimeout); err != nil {
+		return fmt.Errorf("no response after publishing to subject '%s': %w", subject, err)
+	}
+
+	// The connection keeps its last error, so only count violations for this subject
+	if err := nc.LastError(); err != nil && clog.IsAuthRejection(err) && strings.Contains(err.Error(), fmt.Sprintf("%q", subject)) {
+		return fmt.Errorf("publish to subject '%s' rejected: %w", subject, err)
+	}
+	return nil
+}
+
+// doctorCheck prints one check result line
+func doctorCheck(status, name, detail string) {
+	fmt.Printf("  %-6s %-8s %s\n", "["+status+"]", name, detail)
+}
+
+// doctorNetworkFailure reports a failed network step
+func doctorNetworkFailure(step string, err error) int {
+	doctorCheck("FAIL", step, err.Error())
+	fmt.Fprintf(os.Stderr, "503 Service Unavailable: %s check failed: %v\n", step, err)
+	return exitConnectionError
+}
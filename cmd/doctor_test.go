@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestReadServerInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting string
+		wantTLS  bool
+		wantErr  bool
+	}{
+		{
+			name:     "plain server",
+			greeting: "INFO {\"server_id\":\"x\",\"version\":\"2.10.0\"}\r\n",
+			wantTLS:  false,
+		},
+		{
+			name:     "tls required",
+			greeting: "INFO {\"tls_required\":true}\r\n",
+			wantTLS:  true,
+		},
+		{
+			name:     "not a nats server",
+			greeting: "HTTP/1.1 400 Bad Request\r\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				_, _ = server.Write([]byte(tt.greeting))
+				server.Close()
+			}()
+
+			info, err := readServerInfo(client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readServerInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if info.TLSRequired != tt.wantTLS {
+				t.Errorf("TLSRequired = %v, want %v", info.TLSRequired, tt.wantTLS)
+			}
+		})
+	}
+}
+
+func TestDoctorPublishesNoEvents(t *testing.T) {
+	isolateSettings(t)
+	url := startTestServer(t, false)
+	t.Setenv("NATS_URL", url)
+
+	nc, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	sub, err := nc.SubscribeSync(">")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Flush()
+
+	tests := []struct {
+		args        []string
+		wantSubject string // of the only message seen, if any
+		wantCheck   string
+	}{
+		{args: nil, wantCheck: "[skip] publish"},
+		{args: []string{"-publish"}, wantSubject: doctorSubject, wantCheck: "[ok]   probe    " + doctorSubject},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(append([]string{"doctor"}, tt.args...), " "), func(t *testing.T) {
+			var code int
+			out := captureStdout(t, func() { code = runDoctor(tt.args) })
+			if code != exitSuccess {
+				t.Fatalf("runDoctor() = %d\n%s", code, out)
+			}
+			if !strings.Contains(out, tt.wantCheck) {
+				t.Errorf("output missing %q:\n%s", tt.wantCheck, out)
+			}
+
+			// Nothing reaches claude.> or the CLOG stream
+			var seen []string
+			for {
+				msg, err := sub.NextMsg(100 * time.Millisecond)
+				if err != nil {
+					break
+				}
+				seen = append(seen, msg.Subject)
+			}
+			var want []string
+			if tt.wantSubject != "" {
+				want = []string{tt.wantSubject}
+			}
+			if !slices.Equal(seen, want) {
+				t.Errorf("doctor published to %q, want %q", seen, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/davedotdev/clog"
+	"github.com/nats-io/nats.go"
+)
+
+// runFetch downloads an attachment, or the full payload of a truncated
+// event, from the attachments bucket
+func runFetch(args []string) int {
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	outputFlag := fs.String("o", "", "Write to this file instead of stdout")
+	contextFlag := fs.String("context", "", "NATS CLI context name")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: clog fetch [-o file] <object>\n\nDownloads an object named in an event's attachments, e.g. <event id>/plan.md.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	words, err := parseInterspersed(fs, args)
+	if err != nil {
+		return exitInvalidArgs
+	}
+	if len(words) != 1 {
+		fmt.Fprintln(os.Stderr, "400 Bad Request: usage: clog fetch [-o file] <object>")
+		return exitInvalidArgs
+	}
+
+	nc, _, err := connectNATS(*contextFlag)
+	if err != nil {
+		status, code := connectionFailure(err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
+	}
+	defer nc.Close()
+
+	var (
+		w   io.Writer = os.Stdout
+		tmp *os.File
+	)
+	if *outputFlag != "" {
+		// Written beside the target and renamed, so a failed fetch leaves
+		// nothing half-written
+		f, err := os.CreateTemp(filepath.Dir(*outputFlag), ".clog-fetch-*")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "500 Internal Server Error: %v\n", err)
+			return exitInvalidArgs
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		w, tmp = f, f
+	}
+
+	attachment, err := clog.FetchAttachment(context.Background(), nc, words[0], w)
+	if err != nil {
+		status, code := publishFailure(err)
+		if errors.Is(err, nats.ErrObjectNotFound) {
+			status, code = "404 Not Found", exitInvalidArgs
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
+	}
+
+	if tmp != nil {
+		if err := tmp.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "500 Internal Server Error: %v\n", err)
+			return exitInvalidArgs
+		}
+		if err := os.Rename(tmp.Name(), *outputFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "500 Internal Server Error: %v\n", err)
+			return exitInvalidArgs
+		}
+		fmt.Printf("200 OK: wrote %s (%d bytes, %s) to %s\n", attachment.Name, attachment.Size, attachment.Digest, *outputFlag)
+	}
+	return exitSuccess
+}
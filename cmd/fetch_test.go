@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davedotdev/clog"
+)
+
+func TestAttachAndFetch(t *testing.T) {
+	isolateSettings(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "events.jsonl")
+	t.Setenv("NATS_URL", startTestServer(t, true))
+	t.Setenv("CLOG_SINKS", "nats,file:"+file)
+
+	plan := filepath.Join(dir, "plan.md")
+	os.WriteFile(plan, []byte("# Plan\n\n1. Add VAT\n"), 0o600)
+
+	if code := runEventCommand(findEventCommand("task"), []string{"start", "Planning", "-attach", plan, "-idempotency-key=evt-7"}); code != exitSuccess {
+		t.Fatalf("runEventCommand() = %d", code)
+	}
+	data, _ := os.ReadFile(file)
+	var got clog.Message
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("published %q: %v", data, err)
+	}
+	if len(got.Attachments) != 1 || got.Attachments[0].Name != "evt-7/plan.md" {
+		t.Fatalf("attachments = %+v", got.Attachments)
+	}
+
+	out := filepath.Join(dir, "fetched.md")
+	if code := runFetch([]string{"-o", out, "evt-7/plan.md"}); code != exitSuccess {
+		t.Fatalf("runFetch() = %d", code)
+	}
+	if fetched, _ := os.ReadFile(out); string(fetched) != "# Plan\n\n1. Add VAT\n" {
+		t.Errorf("fetched %q", fetched)
+	}
+
+	if code := runFetch([]string{"-o", filepath.Join(dir, "missing"), "evt-7/missing.md"}); code != exitInvalidArgs {
+		t.Errorf("runFetch(missing) = %d, want %d", code, exitInvalidArgs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("failed fetch left a file behind: %v", err)
+	}
+	if code := runFetch(nil); code != exitInvalidArgs {
+		t.Errorf("runFetch() without an object = %d, want %d", code, exitInvalidArgs)
+	}
+}
+
+func TestAttachNeedsNATS(t *testing.T) {
+	isolateSettings(t)
+	dir := t.TempDir()
+	t.Setenv("CLOG_SINKS", "file:"+filepath.Join(dir, "events.jsonl"))
+	plan := filepath.Join(dir, "plan.md")
+	os.WriteFile(plan, []byte("plan"), 0o600)
+
+	if code := runEventCommand(findEventCommand("ask"), []string{"Approve the plan?", "-attach", plan}); code != exitAuthError {
+		t.Errorf("runEventCommand() = %d, want %d", code, exitAuthError)
+	}
+	if code := runEventCommand(findEventCommand("ask"), []string{"Approve the plan?", "-attach", plan + ".missing"}); code != exitInvalidArgs {
+		t.Errorf("runEventCommand() with a missing file = %d, want %d", code, exitInvalidArgs)
+	}
+}
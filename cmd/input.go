@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Longest -message or -user-prompt read from a file or stdin. Events are
+// small NATS messages; anything bigger is almost certainly the wrong file.
+const maxInputSize = 256 << 10
+
+// inputReader resolves -message and -user-prompt values that name their
+// content rather than containing it, so multi-line text with quotes,
+// backticks and $ needs no shell quoting
+type inputReader struct {
+	stdin     io.Reader
+	usedStdin string // flag that already read stdin
+}
+
+// read returns a flag's value: "@path" is the file's contents and "-" is
+// stdin, both byte for byte; "@@text" is the literal "@text". Anything else
+// is returned as is.
+func (r *inputReader) read(name, value string) (string, error) {
+	switch {
+	case value == "-":
+		if r.usedStdin != "" {
+			return "", fmt.Errorf("-%s and -%s cannot both read stdin", r.usedStdin, name)
+		}
+		r.usedStdin = name
+		return readInput(name, "stdin", r.stdin)
+	case strings.HasPrefix(value, "@@"):
+		return value[1:], nil
+	case strings.HasPrefix(value, "@"):
+		path := value[1:]
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("-%s: %v", name, err)
+		}
+		defer f.Close()
+		return readInput(name, path, f)
+	}
+	return value, nil
+}
+
+// readInput reads all of in, which must be valid UTF-8 of at most
+// maxInputSize bytes
+func readInput(name, source string, in io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(in, maxInputSize+1))
+	if err != nil {
+		return "", fmt.Errorf("-%s: reading %s: %v", name, source, err)
+	}
+	if len(data) > maxInputSize {
+		return "", fmt.Errorf("-%s from %s is larger than %d bytes", name, source, maxInputSize)
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("-%s from %s is not valid UTF-8", name, source)
+	}
+	return string(data), nil
+}
+
+// pathList collects a repeatable flag such as -attach
+type pathList []string
+
+func (l *pathList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *pathList) Set(path string) error {
+	if path == "" {
+		return errors.New("empty path")
+	}
+	*l = append(*l, path)
+	return nil
+}
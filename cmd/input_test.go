@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davedotdev/clog"
+)
+
+func TestInputReader(t *testing.T) {
+	dir := t.TempDir()
+	prompt := "Fix `make test`:\n  echo \"$HOME\" 'quoted' \\n\r\n\n"
+	promptFile := filepath.Join(dir, "prompt.txt")
+	os.WriteFile(promptFile, []byte(prompt), 0o600)
+	bigFile := filepath.Join(dir, "big.txt")
+	os.WriteFile(bigFile, []byte(strings.Repeat("x", maxInputSize+1)), 0o600)
+	binaryFile := filepath.Join(dir, "binary")
+	os.WriteFile(binaryFile, []byte{'a', 0xff, 'b'}, 0o600)
+
+	tests := []struct {
+		name    string
+		values  []string // read in turn as -message, -user-prompt
+		stdin   string
+		want    []string
+		wantErr string
+	}{
+		{name: "literal", values: []string{"plain text"}, want: []string{"plain text"}},
+		{name: "file byte for byte", values: []string{"@" + promptFile}, want: []string{prompt}},
+		{name: "stdin byte for byte", values: []string{"Summary", "-"}, stdin: prompt, want: []string{"Summary", prompt}},
+		{name: "escaped @", values: []string{"@@alice please review"}, want: []string{"@alice please review"}},
+		{name: "missing file", values: []string{"@" + filepath.Join(dir, "missing")}, wantErr: "no such file"},
+		{name: "too large", values: []string{"@" + bigFile}, wantErr: "larger than"},
+		{name: "invalid UTF-8", values: []string{"@" + binaryFile}, wantErr: "not valid UTF-8"},
+		{name: "invalid UTF-8 on stdin", values: []string{"-"}, stdin: "\xc3\x28", wantErr: "not valid UTF-8"},
+		{name: "stdin twice", values: []string{"-", "-"}, stdin: "x", wantErr: "cannot both read stdin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &inputReader{stdin: strings.NewReader(tt.stdin)}
+			var got []string
+			var err error
+			for i, value := range tt.values {
+				var s string
+				s, err = r.read([]string{"message", "user-prompt"}[i], value)
+				if err != nil {
+					break
+				}
+				got = append(got, s)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("read() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read() error = %v", err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("read() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventCommandPromptFile(t *testing.T) {
+	isolateSettings(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "events.jsonl")
+	t.Setenv("CLOG_SINKS", "file:"+file)
+
+	prompt := "Rename `$total` to \"sum\"\nand keep the 'old' alias\n"
+	promptFile := filepath.Join(dir, "prompt.txt")
+	os.WriteFile(promptFile, []byte(prompt), 0o600)
+
+	if code := runEventCommand(findEventCommand("task"), []string{"start", "Renaming", "-prompt=@" + promptFile}); code != exitSuccess {
+		t.Fatalf("runEventCommand() = %d", code)
+	}
+	data, _ := os.ReadFile(file)
+	var got clog.Message
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.UserPrompt != prompt {
+		t.Errorf("user_prompt = %q, want %q", got.UserPrompt, prompt)
+	}
+}
+
+func TestFlagFormInputs(t *testing.T) {
+	isolateSettings(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "events.jsonl")
+	t.Setenv("CLOG_SINKS", "file:"+file)
+
+	message := "Fixed `go vet`\n"
+	messageFile := filepath.Join(dir, "message.txt")
+	os.WriteFile(messageFile, []byte(message), 0o600)
+	prompt := "Why does \"$HOME\" vanish?\r\n"
+	promptFile := filepath.Join(dir, "prompt.txt")
+	os.WriteFile(promptFile, []byte(prompt), 0o600)
+
+	// -user-prompt=- reads stdin
+	stdin, err := os.Open(promptFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = oldStdin })
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantPrompt string
+	}{
+		{name: "files", args: []string{"-type=task", "-state=completed", "-message=@" + messageFile, "-user-prompt=@" + promptFile}, wantPrompt: prompt},
+		{name: "stdin", args: []string{"-type=task", "-state=completed", "-message=@" + messageFile, "-user-prompt=-"}, wantPrompt: prompt},
+		{name: "escaped @", args: []string{"-type=task", "-state=completed", "-message=@" + messageFile, "-user-prompt=@@src/main.go why does this panic?"}, wantPrompt: "@src/main.go why does this panic?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(file)
+			if code := runArgs(t, tt.args...); code != exitSuccess {
+				t.Fatalf("run() = %d", code)
+			}
+			data, _ := os.ReadFile(file)
+			var got clog.Message
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Message != message || got.UserPrompt != tt.wantPrompt {
+				t.Errorf("published message %q, user_prompt %q, want %q, %q", got.Message, got.UserPrompt, message, tt.wantPrompt)
+			}
+		})
+	}
+}
+
+func TestEventCommandEscapedPrompt(t *testing.T) {
+	isolateSettings(t)
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	t.Setenv("CLOG_SINKS", "file:"+file)
+
+	if code := runEventCommand(findEventCommand("task"), []string{"start", "-message=@@alice please review", "-prompt=@@src/main.go why does this panic?"}); code != exitSuccess {
+		t.Fatalf("runEventCommand() = %d", code)
+	}
+	data, _ := os.ReadFile(file)
+	var got clog.Message
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Message != "@alice please review" || got.UserPrompt != "@src/main.go why does this panic?" {
+		t.Errorf("published message %q, user_prompt %q", got.Message, got.UserPrompt)
+	}
+}
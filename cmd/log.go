@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/davedotdev/clog"
+)
+
+// Records shown per page by 'clog log'
+const defaultLogPageSize = 20
+
+// runLog pages through the audit log, newest records last
+func runLog(args []string) int {
+	fs := flag.NewFlagSet("log", flag.ContinueOnError)
+	nFlag := fs.Int("n", defaultLogPageSize, "Records per page (0 for all)")
+	pageFlag := fs.Int("page", 1, "Page to show, counting back from the newest")
+	sessionFlag := fs.String("session", "", "Only show records for this session")
+	failedFlag := fs.Bool("failed", false, "Only show failed publishes")
+	jsonFlag := fs.Bool("json", false, "Print raw JSON lines")
+	fileFlag := fs.String("file", "", "Audit log to read (default: the configured audit_log)")
+	contextFlag := fs.String("context", "", "NATS CLI context name")
+	if err := fs.Parse(args); err != nil {
+		return exitInvalidArgs
+	}
+	if *nFlag < 0 || *pageFlag < 1 {
+		fmt.Fprintln(os.Stderr, "400 Bad Request: -n must be >= 0 and -page >= 1")
+		return exitInvalidArgs
+	}
+
+	auditLog := clog.NewAuditLog(*fileFlag, 0)
+	if *fileFlag == "" {
+		s, err := clog.ResolveSettings(*contextFlag, baked())
+		if err == nil {
+			auditLog, err = clog.AuditLogOptions(s)
+		}
+		if err != nil {
+			status, code := connectionFailure(err)
+			fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+			return code
+		}
+		if auditLog == nil {
+			fmt.Fprintln(os.Stderr, "400 Bad Request: no audit log configured (set CLOG_AUDIT_LOG or audit_log in the config file, or use -file)")
+			return exitInvalidArgs
+		}
+	}
+
+	records, err := auditLog.Records()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "500 Internal Server Error: %v\n", err)
+		return exitInvalidArgs
+	}
+
+	var matched []clog.AuditRecord
+	for _, r := range records {
+		if *sessionFlag != "" && r.Message.SessionID != *sessionFlag {
+			continue
+		}
+		if *failedFlag && r.Result == clog.AuditResultOK {
+			continue
+		}
+		matched = append(matched, r)
+	}
+
+	start, end := logPage(len(matched), *nFlag, *pageFlag)
+	page := matched[start:end]
+
+	if *jsonFlag {
+		for _, r := range page {
+			data, err := json.Marshal(r)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "500 Internal Server Error: Failed to marshal JSON: %v\n", err)
+				return exitInvalidArgs
+			}
+			fmt.Println(string(data))
+		}
+		return exitSuccess
+	}
+
+	if len(page) == 0 {
+		fmt.Printf("No audit records in %s\n", auditLog.Path())
+		return exitSuccess
+	}
+	for _, r := range page {
+		printAuditRecord(r)
+	}
+	fmt.Printf("\nRecords %d-%d of %d in %s\n", start+1, end, len(matched), auditLog.Path())
+	if start > 0 {
+		fmt.Printf("Older records: clog log -page=%d\n", *pageFlag+1)
+	}
+	return exitSuccess
+}
+
+// logPage returns the slice bounds of a page of n records out of total,
+// counting pages back from the newest record; n == 0 selects everything
+func logPage(total, n, page int) (int, int) {
+	if n == 0 {
+		return 0, total
+	}
+	end := max(total-(page-1)*n, 0)
+	return max(end-n, 0), end
+}
+
+// printAuditRecord prints one audit record on a line, plus its error if any
+func printAuditRecord(r clog.AuditRecord) {
+	session := ""
+	if r.Message.SessionID != "" {
+		session = "[" + r.Message.SessionID + "] "
+	}
+	fmt.Printf("%s  %-6s  %-32s  %s%s\n", r.Time.Local().Format(time.DateTime), r.Result, r.Subject, session, r.Message.Message)
+	if r.Error != "" {
+		fmt.Printf("%21s error: %s\n", "", r.Error)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestLogPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		n         int
+		page      int
+		wantStart int
+		wantEnd   int
+	}{
+		{name: "newest page", total: 45, n: 20, page: 1, wantStart: 25, wantEnd: 45},
+		{name: "second page", total: 45, n: 20, page: 2, wantStart: 5, wantEnd: 25},
+		{name: "partial last page", total: 45, n: 20, page: 3, wantStart: 0, wantEnd: 5},
+		{name: "past the end", total: 45, n: 20, page: 4, wantStart: 0, wantEnd: 0},
+		{name: "everything", total: 45, n: 0, page: 1, wantStart: 0, wantEnd: 45},
+		{name: "empty log", total: 0, n: 20, page: 1, wantStart: 0, wantEnd: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := logPage(tt.total, tt.n, tt.page)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("logPage() = %d, %d, want %d, %d", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
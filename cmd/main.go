@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,6 +9,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/davedotdev/clog"
+	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nats.go"
 )
 
@@ -20,9 +22,11 @@ const (
 	exitSuccess         = 0
 	exitInvalidArgs     = 1
 	exitConnectionError = 2
+	exitAuthError       = 3
 )
 
-// Baked-in configuration (to be replaced during build with 'make build')
+// Baked-in configuration (set at build time with 'make build', which passes
+// the output of 'clog build-config' to -ldflags; see bakedConfig)
 var (
 	defaultNATSURL  = "nats://localhost:4222"
 	defaultAuthType = "none" // none, userpass, token, nkey, decentralized
@@ -38,38 +42,60 @@ var (
 	reminder3 = ""
 )
 
-// Valid event types
-var validTypes = map[string]bool{
-	"task":     true,
-	"question": true,
-	"progress": true,
-	"session":  true,
-}
-
-// Message represents the JSON structure sent to NATS
-type Message struct {
-	Event      string `json:"event"`
-	Timestamp  string `json:"timestamp"`
-	SessionID  string `json:"session_id,omitempty"`
-	Message    string `json:"message"`
-	UserPrompt string `json:"user_prompt,omitempty"`
-	State      string `json:"state,omitempty"`
-	TaskNum    string `json:"task_num,omitempty"`
-}
-
 func main() {
 	log.SetFlags(0) // Disable timestamp in log output
+	if err := applyBakedConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "500 Internal Server Error: %v\n", err)
+		os.Exit(exitAuthError)
+	}
 	os.Exit(run())
 }
 
 func run() int {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "doctor":
+			return runDoctor(os.Args[2:])
+		case "config":
+			return runConfig(os.Args[2:])
+		case "build-config":
+			return runBuildConfig(os.Args[2:])
+		case "creds":
+			return runCreds(os.Args[2:])
+		case "server":
+			return runServer(os.Args[2:])
+		case "log":
+			return runLog(os.Args[2:])
+		case "mcp":
+			return runMCP(os.Args[2:])
+		case "fetch":
+			return runFetch(os.Args[2:])
+		case "help":
+			if len(os.Args) > 2 {
+				if cmd := findEventCommand(os.Args[2]); cmd != nil {
+					return runEventCommand(cmd, []string{"-h"})
+				}
+			}
+			printHelp()
+			return exitSuccess
+		}
+		if cmd := findEventCommand(os.Args[1]); cmd != nil {
+			return runEventCommand(cmd, os.Args[2:])
+		}
+	}
+
 	// Define flags
 	typeFlag := flag.String("type", "", "Event type: task|question|progress|session")
-	messageFlag := flag.String("message", "", "Message content (string)")
-	userPromptFlag := flag.String("user-prompt", "", "User's input prompt (optional)")
+	messageFlag := flag.String("message", "", "Message content (string, @file, or - for stdin)")
+	userPromptFlag := flag.String("user-prompt", "", "User's input prompt (optional; string, @file, or - for stdin)")
 	stateFlag := flag.String("state", "", "Task state: pending|in_progress|blocked|completed")
 	taskNumFlag := flag.String("task-num", "", "Current task number (e.g., \"3/15\")")
 	sessionFlag := flag.String("session", "", "Session identifier (any string)")
+	idempotencyKeyFlag := flag.String("idempotency-key", "", "Message ID to reuse when retrying, so repeats are dropped (optional)")
+	var attachFlag pathList
+	flag.Var(&attachFlag, "attach", "File to upload to the object store with the event (repeatable)")
+	contextFlag := flag.String("context", "", "NATS CLI context name (default: $NATS_CONTEXT or selected context)")
 	helpFlag := flag.Bool("h", false, "Show help")
 	versionFlag := flag.Bool("v", false, "Show version")
 
@@ -78,6 +104,7 @@ func run() int {
 	// Show version
 	if *versionFlag {
 		fmt.Printf("clog version %s\n", version)
+		fmt.Println(bakedSummary())
 		return exitSuccess
 	}
 
@@ -87,184 +114,122 @@ func run() int {
 		return exitSuccess
 	}
 
-	// Validate inputs
-	if err := validateFlags(*typeFlag, *messageFlag); err != nil {
+	// -message and -user-prompt may name a file or stdin
+	inputs := &inputReader{stdin: os.Stdin}
+	var err error
+	*messageFlag, err = inputs.read("message", *messageFlag)
+	if err == nil {
+		*userPromptFlag, err = inputs.read("user-prompt", *userPromptFlag)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "400 Bad Request: %v\n", err)
 		return exitInvalidArgs
 	}
 
-	// Map type and state to subject
-	subject := mapSubject(*typeFlag, *stateFlag)
-
-	// Create message
-	msg := Message{
-		Event:      subject,
-		Timestamp:  time.Now().UTC().Format(time.RFC3339),
-		SessionID:  *sessionFlag,
+	event := clog.Event{
+		Type:       *typeFlag,
+		State:      *stateFlag,
 		Message:    *messageFlag,
 		UserPrompt: *userPromptFlag,
-		State:      *stateFlag,
 		TaskNum:    *taskNumFlag,
+		SessionID:  *sessionFlag,
+		Timestamp:  time.Now(),
+		ID:         *idempotencyKeyFlag,
+
+		AttachPaths: attachFlag,
 	}
+	return publishEvent(event, *contextFlag)
+}
 
-	// Marshal to JSON
-	jsonData, err := json.Marshal(msg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "500 Internal Server Error: Failed to marshal JSON: %v\n", err)
+// publishEvent validates and publishes an event to the configured sinks,
+// printing the status line and reminders, and returns the exit code
+func publishEvent(event clog.Event, contextName string) int {
+	// Validate inputs
+	if err := event.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "400 Bad Request: %v\n", err)
 		return exitInvalidArgs
 	}
 
-	// Connect to NATS
-	nc, err := connectNATS()
+	// Open the configured sinks (NATS unless configured otherwise)
+	s, err := clog.ResolveSettings(contextName, baked())
+	if err != nil {
+		status, code := connectionFailure(err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
+	}
+	sinks, err := openSinks(s)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "503 Service Unavailable: NATS connection failed: %v\n", err)
-		return exitConnectionError
+		status, code := connectionFailure(err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
 	}
-	defer nc.Close()
+	defer sinks.Close()
 
 	// Publish message
-	if err := publishMessage(nc, subject, jsonData); err != nil {
-		fmt.Fprintf(os.Stderr, "503 Service Unavailable: %v\n", err)
-		return exitConnectionError
+	if err := sinks.Publish(context.Background(), event); err != nil {
+		status, code := publishFailure(err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", status, err)
+		return code
 	}
 
-	// Success - print confirmation
-	printSuccess(*typeFlag, *userPromptFlag, *stateFlag)
+	// Success - print confirmation, with a reminder if the event was dropped
+	// or held back rather than published
+	warnings := append([]string{clog.ExpiryReminder(sinks.claims, time.Now())}, sinks.dropped...)
+	warnings = append(warnings, sinks.warnings...)
+	printSuccess(event, warnings...)
 	return exitSuccess
 }
 
-// validateFlags validates required flags and event type
-func validateFlags(eventType, message string) error {
-	if eventType == "" || message == "" {
-		return errors.New("-type and -message are required")
-	}
-
-	if !validTypes[eventType] {
-		return fmt.Errorf("invalid type '%s'. Must be: task|question|progress|session", eventType)
+// connectNATS establishes a connection to NATS using the baked-in defaults and
+// the usual overrides, optionally taken from a named NATS CLI context
+func connectNATS(contextName string) (*nats.Conn, *jwt.UserClaims, error) {
+	s, err := clog.ResolveSettings(contextName, baked())
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return nil
+	return clog.Connect(s)
 }
 
-// connectNATS establishes a connection to NATS using available credentials
-func connectNATS() (*nats.Conn, error) {
-	natsURL := os.Getenv("NATS_URL")
-	if natsURL == "" {
-		natsURL = defaultNATSURL
+// connectionFailure maps a connectNATS error to an HTTP-style status and exit code
+func connectionFailure(err error) (string, int) {
+	switch {
+	case errors.Is(err, clog.ErrInvalidConfig):
+		return "400 Bad Request: clog configuration is invalid", exitAuthError
+	case errors.Is(err, clog.ErrInvalidCredentials):
+		return "401 Unauthorized: NATS credentials are invalid", exitAuthError
+	case clog.IsAuthRejection(err):
+		return "403 Forbidden: NATS server rejected credentials", exitAuthError
+	default:
+		return "503 Service Unavailable: NATS connection failed", exitConnectionError
 	}
-
-	var opts []nats.Option
-
-	// Check for environment variable overrides first
-	natsCredsFile := os.Getenv("NATS_CREDS")
-	envUsername := os.Getenv("NATS_USERNAME")
-	envPassword := os.Getenv("NATS_PASSWORD")
-	envToken := os.Getenv("NATS_TOKEN")
-	envNKey := os.Getenv("NATS_NKEY")
-	envJWT := os.Getenv("NATS_JWT")
-	envSeed := os.Getenv("NATS_SEED")
-
-	// Priority order for authentication:
-	// 1. Credentials file (from env)
-	// 2. Environment variables (username/password, token, nkey, or JWT/seed)
-	// 3. Baked-in credentials (based on defaultAuthType)
-
-	if natsCredsFile != "" {
-		// Use credentials file
-		opts = append(opts, nats.UserCredentials(natsCredsFile))
-	} else if envUsername != "" && envPassword != "" {
-		// Use username/password from environment
-		opts = append(opts, nats.UserInfo(envUsername, envPassword))
-	} else if envToken != "" {
-		// Use token from environment
-		opts = append(opts, nats.Token(envToken))
-	} else if envNKey != "" {
-		// Use NKey from environment
-		opt, err := nats.NkeyOptionFromSeed(envNKey)
-		if err == nil {
-			opts = append(opts, opt)
-		}
-	} else if envJWT != "" && envSeed != "" {
-		// Use JWT/Seed from environment (decentralized auth)
-		opts = append(opts, nats.UserJWTAndSeed(envJWT, envSeed))
-	} else {
-		// Use baked-in credentials based on auth type
-		switch defaultAuthType {
-		case "userpass":
-			if defaultUsername != "" && defaultPassword != "" {
-				opts = append(opts, nats.UserInfo(defaultUsername, defaultPassword))
-			}
-		case "token":
-			if defaultToken != "" {
-				opts = append(opts, nats.Token(defaultToken))
-			}
-		case "nkey":
-			if defaultNKey != "" {
-				opt, err := nats.NkeyOptionFromSeed(defaultNKey)
-				if err == nil {
-					opts = append(opts, opt)
-				}
-			}
-		case "decentralized":
-			if defaultNATSJWT != "" && defaultNATSSeed != "" {
-				opts = append(opts, nats.UserJWTAndSeed(defaultNATSJWT, defaultNATSSeed))
-			}
-		case "none":
-			// No authentication
-		default:
-			// No authentication
-		}
-	}
-
-	return nats.Connect(natsURL, opts...)
 }
 
-// publishMessage publishes a message to NATS with flush and timeout
-func publishMessage(nc *nats.Conn, subject string, data []byte) error {
-	if err := nc.Publish(subject, data); err != nil {
-		return fmt.Errorf("failed to publish message to subject '%s': %w", subject, err)
-	}
-
-	if err := nc.Flush(); err != nil {
-		return fmt.Errorf("failed to flush message to server: %w", err)
+// publishFailure maps a publish error to an HTTP-style status and exit code
+func publishFailure(err error) (string, int) {
+	switch {
+	case errors.Is(err, clog.ErrInvalidConfig), errors.Is(err, clog.ErrInvalidCredentials):
+		return connectionFailure(err)
+	case errors.Is(err, clog.ErrInvalidEvent):
+		return "400 Bad Request", exitInvalidArgs
+	case errors.Is(err, clog.ErrSessionScope), clog.IsAuthRejection(err):
+		return "403 Forbidden", exitAuthError
+	default:
+		return "503 Service Unavailable", exitConnectionError
 	}
-
-	if err := nc.FlushTimeout(5 * time.Second); err != nil {
-		return fmt.Errorf("message delivery timeout: %w", err)
-	}
-
-	return nil
 }
 
 // printSuccess prints a success message with HTTP-style status code and reminders
-func printSuccess(eventType, userPrompt, state string) {
+func printSuccess(event clog.Event, warnings ...string) {
 	// Simple HTTP-style status output
 	fmt.Println("200 OK")
 
 	// Display reminders if configured
-	printReminders(eventType, userPrompt, state)
+	printReminders(event, warnings...)
 }
 
-// printReminders displays configured reminders and context-specific tips
-func printReminders(eventType, userPrompt, state string) {
-	reminders := []string{}
-
-	// User-configured reminders (collected at build time)
-	if reminder1 != "" {
-		reminders = append(reminders, reminder1)
-	}
-	if reminder2 != "" {
-		reminders = append(reminders, reminder2)
-	}
-	if reminder3 != "" {
-		reminders = append(reminders, reminder3)
-	}
-
-	// Context-specific reminders for AI agents
-	contextReminder := getContextReminder(eventType, userPrompt, state)
-	if contextReminder != "" {
-		reminders = append(reminders, contextReminder)
-	}
+// printReminders displays warnings, configured reminders and context-specific tips
+func printReminders(event clog.Event, warnings ...string) {
+	reminders := reminderLines(event, warnings...)
 
 	// Print reminders if any exist
 	if len(reminders) > 0 {
@@ -275,75 +240,21 @@ func printReminders(eventType, userPrompt, state string) {
 	}
 }
 
-// getContextReminder returns context-specific reminder based on event type and state
-func getContextReminder(eventType, userPrompt, state string) string {
-	switch eventType {
-	case "task":
-		switch state {
-		case "in_progress":
-			if userPrompt == "" {
-				return "TIP: Add -user-prompt=\"<exact user text>\" to capture full context (VERBATIM user input)"
-			}
-			return "Remember: Log completion when done: clog -type=task -state=completed -message=\"...\" -session=\"...\""
-		case "completed":
-			return "Next: Log next task or use -type=progress for multi-step work"
-		case "blocked":
-			return "Consider: Use -type=question -state=blocked if waiting for user input"
-		}
-	case "question":
-		if state == "blocked" {
-			return "Good: Always log questions before asking user"
-		}
-	case "progress":
-		return "" // No reminder needed for progress updates
-	case "session":
-		if state == "" || state == "in_progress" {
-			return "Remember: Log tasks with -type=task as you work"
-		}
-	}
-	return ""
-}
-
-// mapSubject maps event type and state to NATS subject
-func mapSubject(eventType, state string) string {
-	baseSubject := fmt.Sprintf("claude.%ss", eventType)
-
-	// For tasks, append state-specific suffix
-	if eventType == "task" && state != "" {
-		switch state {
-		case "in_progress":
-			return "claude.tasks.started"
-		case "completed":
-			return "claude.tasks.completed"
-		case "blocked":
-			return "claude.tasks.blocked"
-		default:
-			return baseSubject
-		}
-	}
-
-	// For questions
-	if eventType == "question" {
-		if state == "blocked" {
-			return "claude.questions.waiting"
-		}
-		return "claude.questions.asked"
-	}
-
-	// For progress
-	if eventType == "progress" {
-		return "claude.progress.update"
-	}
+// reminderLines returns the warnings, configured reminders and
+// context-specific tip to show after publishing an event
+func reminderLines(event clog.Event, warnings ...string) []string {
+	reminders := []string{}
 
-	// For session
-	if eventType == "session" {
-		if state == "completed" {
-			return "claude.session.completed"
+	// Warnings such as credential expiry come first
+	for _, warning := range warnings {
+		if warning != "" {
+			reminders = append(reminders, warning)
 		}
-		return "claude.session.started"
 	}
 
-	return baseSubject
+	// User-configured reminders (collected at build time), then the tip for
+	// AI agents
+	return append(reminders, clog.Reminders(event, reminder1, reminder2, reminder3)...)
 }
 
 func printHelp() {
@@ -351,19 +262,38 @@ func printHelp() {
 
 USAGE:
   clog -type=<event_type> -message="<text>" [options]
+  clog task start|done|block|pending ["message"] [options]
+  clog ask "question" [options]
+  clog progress [N/M] ["message"] [options]
+  clog session start|end ["message"] [options]
+  clog help <command>      # Help for task, ask, progress or session
+  clog doctor [-publish]   # Diagnose connectivity and credentials
+  clog config show [-json] # Show resolved configuration and sources
+  clog build-config [...]  # Print -ldflags that bake a configuration in
+  clog creds mint [...]    # Mint short-lived creds scoped to one session
+  clog server [-jetstream] # Run an embedded NATS server for local use
+  clog log [-n=20] [-page=N] # Page through the local audit log
+  clog mcp [-session=<id>] # Serve clog as MCP tools over stdio
+  clog fetch [-o file] <object> # Download an event attachment
   clog -v                  # Show version
   clog -h                  # Show help
 
 REQUIRED FLAGS:
   -type        Event type: task|question|progress|session
-  -message     Message content (string)
+  -message     Message content (string, @file, or - for stdin)
 
 OPTIONAL FLAGS:
-  -user-prompt User's EXACT, VERBATIM input (DO NOT summarize or paraphrase)
+  -user-prompt User's EXACT, VERBATIM input (DO NOT summarize or paraphrase);
+               use @file or - (stdin) for multi-line text with quotes, backticks or $,
+               and @@ for text that starts with a literal @
   -state       Task state: pending|in_progress|blocked|completed
   -task-num    Current task number (e.g., "3/15")
   -session     Session identifier (any string)
-  -v           Show version
+  -idempotency-key
+               Message ID to reuse when retrying; repeats are dropped
+  -attach      File to upload to the clog_attachments object store (repeatable)
+  -context     NATS CLI context to use (default: $NATS_CONTEXT or 'nats context select')
+  -v           Show version and baked auth type/host
   -h           Show help
 
 FOR CLAUDE CODE (AI Assistant):
@@ -420,5 +350,43 @@ SUBJECTS (hardwired):
 EXIT CODES:
   0 - Success
   1 - Invalid arguments
-  2 - NATS connection failed`)
+  2 - NATS connection failed
+  3 - NATS credentials or configuration invalid or rejected
+
+CONFIGURATION:
+  Settings come from environment variables (NATS_URL, NATS_CREDS, ...),
+  then the NATS CLI context (-context, $NATS_CONTEXT or 'nats context select'),
+  then the config file ($CLOG_CONFIG or ~/.config/clog/config.json),
+  then values baked in at build time. Run 'clog config show' to see which apply.
+  A credential_helper command ($CLOG_CREDENTIAL_HELPER or the config file)
+  can supply rotating credentials as JSON on stdout.
+  Events go to NATS unless CLOG_SINKS (or "sinks" in the config file) lists
+  other sinks: nats, stdout, file:<path>, http(s)://<url>. CLOG_SINK_POLICY
+  is "all" (any failing sink fails; default) or "any".
+  CLOG_AUDIT_LOG (or "audit_log") names a JSONL file that records every
+  publish and its result, rotated at CLOG_AUDIT_LOG_MAX_SIZE (default 10M).
+  CLOG_FORMAT=cloudevents (or cloudevents-binary) publishes CloudEvents 1.0.
+  CLOG_OTLP_ENDPOINT (or "otlp_endpoint") exports sessions as traces and
+  tasks as spans to an OTLP/HTTP collector, e.g. http://localhost:4318.
+  Session events carry a "seq" number kept per session; CLOG_SEQUENCE
+  (or "sequence") is local (default), kv (a NATS JetStream KV bucket) or off.
+  Repeats of an -idempotency-key within CLOG_DEDUPE_WINDOW (or
+  "dedupe_window", default 10s) are dropped; CLOG_DEDUPE=content also drops
+  exact repeats of progress and session events, and off disables it.
+  Dropped events still print 200 OK, with a note in the reminders. JetStream
+  streams dedupe on the Nats-Msg-Id header.
+  CLOG_RATE_LIMIT (or "rate_limit") limits chatty types per session, e.g.
+  progress=1/10s; excess events are coalesced (the latest goes out with the
+  next clog call once the limit allows, or the session's next event) or
+  dropped (CLOG_RATE_LIMIT_MODE=drop). Task and question events are never
+  limited.
+  Secrets and emails in messages and prompts are replaced with
+  [REDACTED:<rule>]. CLOG_REDACT_RULES (or "redact_rules") adds name=regex
+  rules, one per line or @file; CLOG_REDACT=off disables the built-in ones.
+  CLOG_PRIVACY (or "privacy") is off (default), omit (drop prompts) or hash
+  (salted hashes and lengths of messages and prompts; CLOG_PRIVACY_SALT sets
+  the salt). A .clog.json file in a project can raise it: {"privacy":"hash"}.
+  CLOG_COMPRESSION (or "compression") set to gzip or s2 compresses NATS and
+  HTTP payloads over CLOG_COMPRESSION_THRESHOLD (default 1K), noted in a
+  Content-Encoding header.`)
 }
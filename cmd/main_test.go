@@ -1,283 +1,28 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
-)
-
-func TestValidateFlags(t *testing.T) {
-	tests := []struct {
-		name      string
-		eventType string
-		message   string
-		wantErr   bool
-	}{
-		{
-			name:      "valid task type with message",
-			eventType: "task",
-			message:   "Test message",
-			wantErr:   false,
-		},
-		{
-			name:      "valid question type with message",
-			eventType: "question",
-			message:   "Test question",
-			wantErr:   false,
-		},
-		{
-			name:      "valid progress type with message",
-			eventType: "progress",
-			message:   "50% complete",
-			wantErr:   false,
-		},
-		{
-			name:      "valid session type with message",
-			eventType: "session",
-			message:   "Session started",
-			wantErr:   false,
-		},
-		{
-			name:      "missing event type",
-			eventType: "",
-			message:   "Test message",
-			wantErr:   true,
-		},
-		{
-			name:      "missing message",
-			eventType: "task",
-			message:   "",
-			wantErr:   true,
-		},
-		{
-			name:      "invalid event type",
-			eventType: "invalid",
-			message:   "Test message",
-			wantErr:   true,
-		},
-		{
-			name:      "both missing",
-			eventType: "",
-			message:   "",
-			wantErr:   true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := validateFlags(tt.eventType, tt.message)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("validateFlags() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestMapSubject(t *testing.T) {
-	tests := []struct {
-		name      string
-		eventType string
-		state     string
-		want      string
-	}{
-		// Task mappings
-		{
-			name:      "task in_progress",
-			eventType: "task",
-			state:     "in_progress",
-			want:      "claude.tasks.started",
-		},
-		{
-			name:      "task completed",
-			eventType: "task",
-			state:     "completed",
-			want:      "claude.tasks.completed",
-		},
-		{
-			name:      "task blocked",
-			eventType: "task",
-			state:     "blocked",
-			want:      "claude.tasks.blocked",
-		},
-		{
-			name:      "task with pending state",
-			eventType: "task",
-			state:     "pending",
-			want:      "claude.tasks",
-		},
-		{
-			name:      "task without state",
-			eventType: "task",
-			state:     "",
-			want:      "claude.tasks",
-		},
-		// Question mappings
-		{
-			name:      "question blocked",
-			eventType: "question",
-			state:     "blocked",
-			want:      "claude.questions.waiting",
-		},
-		{
-			name:      "question without state",
-			eventType: "question",
-			state:     "",
-			want:      "claude.questions.asked",
-		},
-		{
-			name:      "question with any other state",
-			eventType: "question",
-			state:     "answered",
-			want:      "claude.questions.asked",
-		},
-		// Progress mappings
-		{
-			name:      "progress",
-			eventType: "progress",
-			state:     "",
-			want:      "claude.progress.update",
-		},
-		{
-			name:      "progress with state",
-			eventType: "progress",
-			state:     "50",
-			want:      "claude.progress.update",
-		},
-		// Session mappings
-		{
-			name:      "session completed",
-			eventType: "session",
-			state:     "completed",
-			want:      "claude.session.completed",
-		},
-		{
-			name:      "session started",
-			eventType: "session",
-			state:     "",
-			want:      "claude.session.started",
-		},
-		{
-			name:      "session with any other state",
-			eventType: "session",
-			state:     "active",
-			want:      "claude.session.started",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := mapSubject(tt.eventType, tt.state)
-			if got != tt.want {
-				t.Errorf("mapSubject() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
 
-func TestMessageJSONMarshaling(t *testing.T) {
-	tests := []struct {
-		name    string
-		msg     Message
-		wantErr bool
-	}{
-		{
-			name: "complete message",
-			msg: Message{
-				Event:     "claude.tasks.started",
-				Timestamp: "2025-10-09T14:30:00Z",
-				SessionID: "test-session",
-				Message:   "Test message",
-				State:     "in_progress",
-				TaskNum:   "3/15",
-			},
-			wantErr: false,
-		},
-		{
-			name: "message with empty optional fields",
-			msg: Message{
-				Event:     "claude.progress.update",
-				Timestamp: "2025-10-09T14:30:00Z",
-				Message:   "50% complete",
-			},
-			wantErr: false,
-		},
-		{
-			name: "message with only required fields",
-			msg: Message{
-				Event:     "claude.questions.asked",
-				Timestamp: "2025-10-09T14:30:00Z",
-				Message:   "What should I do?",
-			},
-			wantErr: false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			data, err := json.Marshal(tt.msg)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("json.Marshal() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if err == nil {
-				// Verify we can unmarshal it back
-				var unmarshaled Message
-				if err := json.Unmarshal(data, &unmarshaled); err != nil {
-					t.Errorf("json.Unmarshal() error = %v", err)
-				}
-
-				// Verify required fields match
-				if unmarshaled.Event != tt.msg.Event {
-					t.Errorf("Event mismatch: got %v, want %v", unmarshaled.Event, tt.msg.Event)
-				}
-				if unmarshaled.Message != tt.msg.Message {
-					t.Errorf("Message mismatch: got %v, want %v", unmarshaled.Message, tt.msg.Message)
-				}
-			}
-		})
-	}
-}
-
-func TestMessageOmitEmpty(t *testing.T) {
-	msg := Message{
-		Event:     "claude.tasks.started",
-		Timestamp: "2025-10-09T14:30:00Z",
-		Message:   "Test message",
-		// SessionID, State, and TaskNum are empty
-	}
-
-	data, err := json.Marshal(msg)
-	if err != nil {
-		t.Fatalf("json.Marshal() error = %v", err)
-	}
-
-	// Parse the JSON to check that empty fields are omitted
-	var rawJSON map[string]any
-	if err := json.Unmarshal(data, &rawJSON); err != nil {
-		t.Fatalf("json.Unmarshal() error = %v", err)
-	}
-
-	// Check that optional fields are not present in JSON
-	if _, exists := rawJSON["session_id"]; exists {
-		t.Error("session_id should be omitted when empty")
-	}
-	if _, exists := rawJSON["state"]; exists {
-		t.Error("state should be omitted when empty")
-	}
-	if _, exists := rawJSON["task_num"]; exists {
-		t.Error("task_num should be omitted when empty")
-	}
+	"github.com/davedotdev/clog"
+	"github.com/nats-io/nats.go"
+)
 
-	// Check that required fields are present
-	if _, exists := rawJSON["event"]; !exists {
-		t.Error("event should be present")
-	}
-	if _, exists := rawJSON["timestamp"]; !exists {
-		t.Error("timestamp should be present")
-	}
-	if _, exists := rawJSON["message"]; !exists {
-		t.Error("message should be present")
-	}
+// isolateSettings clears NATS environment variables and points CLOG_CONFIG
+// and the NATS CLI config directory at temporary paths so tests never read the
+// developer's real configuration
+func isolateSettings(t *testing.T) {
+	t.Helper()
+	for _, name := range clog.EnvNames {
+		t.Setenv(name, "")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("CLOG_CONFIG", filepath.Join(t.TempDir(), "config.json"))
 }
 
 func TestPrintSuccess(t *testing.T) {
@@ -317,90 +62,7 @@ func TestPrintSuccess(t *testing.T) {
 					t.Errorf("printSuccess() panicked: %v", r)
 				}
 			}()
-			printSuccess(tt.eventType, tt.userPrompt, tt.state)
-		})
-	}
-}
-
-func TestGetContextReminder(t *testing.T) {
-	tests := []struct {
-		name       string
-		eventType  string
-		userPrompt string
-		state      string
-		want       string
-	}{
-		{
-			name:       "task in_progress with user prompt",
-			eventType:  "task",
-			userPrompt: "user input",
-			state:      "in_progress",
-			want:       "Remember: Log completion when done: clog -type=task -state=completed -message=\"...\" -session=\"...\"",
-		},
-		{
-			name:       "task in_progress without user prompt",
-			eventType:  "task",
-			userPrompt: "",
-			state:      "in_progress",
-			want:       "TIP: Add -user-prompt=\"<exact user text>\" to capture full context (VERBATIM user input)",
-		},
-		{
-			name:       "task completed",
-			eventType:  "task",
-			userPrompt: "",
-			state:      "completed",
-			want:       "Next: Log next task or use -type=progress for multi-step work",
-		},
-		{
-			name:       "task blocked",
-			eventType:  "task",
-			userPrompt: "",
-			state:      "blocked",
-			want:       "Consider: Use -type=question -state=blocked if waiting for user input",
-		},
-		{
-			name:       "question blocked",
-			eventType:  "question",
-			userPrompt: "",
-			state:      "blocked",
-			want:       "Good: Always log questions before asking user",
-		},
-		{
-			name:       "progress",
-			eventType:  "progress",
-			userPrompt: "",
-			state:      "",
-			want:       "",
-		},
-		{
-			name:       "session started",
-			eventType:  "session",
-			userPrompt: "",
-			state:      "",
-			want:       "Remember: Log tasks with -type=task as you work",
-		},
-		{
-			name:       "session in_progress",
-			eventType:  "session",
-			userPrompt: "",
-			state:      "in_progress",
-			want:       "Remember: Log tasks with -type=task as you work",
-		},
-		{
-			name:       "session completed",
-			eventType:  "session",
-			userPrompt: "",
-			state:      "completed",
-			want:       "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := getContextReminder(tt.eventType, tt.userPrompt, tt.state)
-			if got != tt.want {
-				t.Errorf("getContextReminder() = %q, want %q", got, tt.want)
-			}
+			printSuccess(clog.Event{Type: tt.eventType, UserPrompt: tt.userPrompt, State: tt.state})
 		})
 	}
 }
@@ -416,22 +78,35 @@ func TestExitCodes(t *testing.T) {
 	if exitConnectionError != 2 {
 		t.Errorf("exitConnectionError should be 2, got %d", exitConnectionError)
 	}
+	if exitAuthError != 3 {
+		t.Errorf("exitAuthError should be 3, got %d", exitAuthError)
+	}
 }
 
-func TestValidTypes(t *testing.T) {
-	expectedTypes := []string{"task", "question", "progress", "session"}
+// runArgs runs the CLI with args as if from the command line, with fresh
+// global flags
+func runArgs(t *testing.T, args ...string) int {
+	t.Helper()
+	oldArgs, oldFlags := os.Args, flag.CommandLine
+	t.Cleanup(func() { os.Args, flag.CommandLine = oldArgs, oldFlags })
+	os.Args = append([]string{"clog"}, args...)
+	flag.CommandLine = flag.NewFlagSet("clog", flag.ContinueOnError)
+	return run()
+}
 
-	for _, typ := range expectedTypes {
-		if !validTypes[typ] {
-			t.Errorf("validTypes should contain '%s'", typ)
-		}
-	}
+func TestFlagFormStates(t *testing.T) {
+	isolateSettings(t)
+	t.Setenv("CLOG_SINKS", "file:"+filepath.Join(t.TempDir(), "events.jsonl"))
 
-	// Check that unexpected types are not valid
-	invalidTypes := []string{"invalid", "foo", "bar", ""}
-	for _, typ := range invalidTypes {
-		if validTypes[typ] {
-			t.Errorf("validTypes should not contain '%s'", typ)
+	// The flag form publishes whatever -state it is given, as it always has;
+	// only the MCP tools limit states to their schemas
+	for _, args := range [][]string{
+		{"-type=progress", "-state=in_progress", "-message=x"},
+		{"-type=question", "-state=pending", "-message=x"},
+		{"-type=task", "-state=pending", "-message=x"},
+	} {
+		if code := runArgs(t, args...); code != exitSuccess {
+			t.Errorf("run(%q) = %d, want %d", args, code, exitSuccess)
 		}
 	}
 }
@@ -490,38 +165,39 @@ func TestConnectNATSWithEnvVars(t *testing.T) {
 		expectError bool
 	}{
 		{
-			name:        "none authentication",
-			authType:    "none",
-			expectError: true, // Will fail without NATS server
+			name:     "none authentication",
+			authType: "none",
 		},
 		{
-			name:        "userpass authentication",
-			authType:    "userpass",
-			username:    "testuser",
-			password:    "testpass",
-			expectError: true, // Will fail without NATS server
+			name:     "userpass authentication",
+			authType: "userpass",
+			username: "testuser",
+			password: "testpass",
 		},
 		{
-			name:        "token authentication",
-			authType:    "token",
-			token:       "testtoken",
-			expectError: true, // Will fail without NATS server
+			name:     "token authentication",
+			authType: "token",
+			token:    "testtoken",
 		},
 		{
 			name:        "nkey authentication",
 			authType:    "nkey",
 			nkey:        "SUAKTEST",
-			expectError: true, // Will fail without NATS server
+			expectError: true, // Not a valid seed
 		},
 		{
 			name:        "decentralized authentication",
 			authType:    "decentralized",
 			jwt:         "test.jwt.token",
 			seed:        "SUAKTEST",
-			expectError: true, // Will fail without NATS server
+			expectError: true, // Not a valid JWT
 		},
 	}
 
+	// The embedded server has no auth, so it accepts any well-formed credentials
+	isolateSettings(t)
+	url := startTestServer(t, false)
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Set up test configuration
@@ -532,15 +208,111 @@ func TestConnectNATSWithEnvVars(t *testing.T) {
 			defaultNKey = tt.nkey
 			defaultNATSJWT = tt.jwt
 			defaultNATSSeed = tt.seed
-			defaultNATSURL = "nats://localhost:14222" // Use non-standard port
+			defaultNATSURL = url
 
-			// This will fail because there's no NATS server, but we're testing
-			// that the function constructs the connection attempt correctly
-			_, err := connectNATS()
+			nc, _, err := connectNATS("")
+			if err == nil {
+				nc.Close()
+			}
+
+			if (err != nil) != tt.expectError {
+				t.Errorf("connectNATS() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestConnectNATSInvalidCredentials(t *testing.T) {
+	origAuthType := defaultAuthType
+	origNKey := defaultNKey
+	defer func() {
+		defaultAuthType = origAuthType
+		defaultNKey = origNKey
+	}()
+
+	tests := []struct {
+		name     string
+		authType string
+		nkey     string
+		env      map[string]string
+	}{
+		{
+			name: "env nkey is not a seed",
+			env:  map[string]string{"NATS_NKEY": "SUAKTEST"},
+		},
+		{
+			name: "env username without password",
+			env:  map[string]string{"NATS_USERNAME": "testuser"},
+		},
+		{
+			name: "env jwt without seed",
+			env:  map[string]string{"NATS_JWT": "test.jwt.token"},
+		},
+		{
+			name: "env creds file missing",
+			env:  map[string]string{"NATS_CREDS": "/nonexistent/clog.creds"},
+		},
+		{
+			name:     "baked nkey is not a seed",
+			authType: "nkey",
+			nkey:     "SUAKTEST",
+		},
+		{
+			name:     "baked unknown auth type",
+			authType: "kerberos",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateSettings(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			defaultAuthType = tt.authType
+			defaultNKey = tt.nkey
+
+			_, _, err := connectNATS("")
+			if !errors.Is(err, clog.ErrInvalidCredentials) {
+				t.Errorf("connectNATS() error = %v, want clog.ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestConnectionFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+	}{
+		{
+			name:     "invalid credentials",
+			err:      clog.CredentialError("NATS_NKEY", errors.New("bad seed")),
+			wantCode: exitAuthError,
+		},
+		{
+			name:     "authorization violation",
+			err:      nats.ErrAuthorization,
+			wantCode: exitAuthError,
+		},
+		{
+			name:     "permissions violation",
+			err:      fmt.Errorf("publish rejected: %w", errors.New("nats: permissions violation for publish to \"claude.tasks\"")),
+			wantCode: exitAuthError,
+		},
+		{
+			name:     "no servers",
+			err:      nats.ErrNoServers,
+			wantCode: exitConnectionError,
+		},
+	}
 
-			// We expect an error because no NATS server is running
-			if err == nil && tt.expectError {
-				t.Error("Expected error due to no NATS server, but got nil")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got := connectionFailure(tt.err)
+			if got != tt.wantCode {
+				t.Errorf("connectionFailure() code = %d, want %d", got, tt.wantCode)
 			}
 		})
 	}
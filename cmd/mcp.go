@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davedotdev/clog"
+	"github.com/nats-io/nats.go"
+)
+
+// MCP protocol revision implemented by 'clog mcp'
+const mcpProtocolVersion = "2024-11-05"
+
+// Largest JSON-RPC message accepted on stdin
+const mcpMaxMessage = 4 << 20
+
+// How long check_control waits for the server to deliver pending messages
+const mcpFlushTimeout = 5 * time.Second
+
+// Control messages for agents arrive on claude.control (every session) and
+// claude.control.<session>
+const controlSubject = "claude.control"
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool is a tool advertised by 'clog mcp'. Event tools publish an event
+// of eventType; the rest are handled by name.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+
+	eventType string
+	state     string // fixed state, for tools whose schema has none
+}
+
+// mcpTools lists the tools, with input schemas generated from the event
+// validation rules
+func mcpTools() []mcpTool {
+	withoutState := func(eventType string) map[string]any {
+		schema := clog.EventSchema(eventType)
+		delete(schema["properties"].(map[string]any), "state")
+		return schema
+	}
+	logTask := clog.EventSchema("task")
+	logTask["required"] = []string{"message", "state"}
+
+	return []mcpTool{
+		{
+			Name:        "start_session",
+			Description: "Log the start of a work session. Use the same session_id for every event in the session.",
+			InputSchema: withoutState("session"),
+			eventType:   "session",
+		},
+		{
+			Name:        "end_session",
+			Description: "Log the end of a work session.",
+			InputSchema: withoutState("session"),
+			eventType:   "session",
+			state:       "completed",
+		},
+		{
+			Name:        "log_task",
+			Description: "Log a task changing state. Log in_progress with the user's verbatim prompt when starting task-based work, and completed or blocked when it ends.",
+			InputSchema: logTask,
+			eventType:   "task",
+		},
+		{
+			Name:        "ask_question",
+			Description: "Log a question before asking the user. Set state to blocked when you are waiting for the answer.",
+			InputSchema: clog.EventSchema("question"),
+			eventType:   "question",
+		},
+		{
+			Name:        "report_progress",
+			Description: "Report progress on multi-step work, e.g. \"50% complete (5/10 tasks)\".",
+			InputSchema: clog.EventSchema("progress"),
+			eventType:   "progress",
+		},
+		{
+			Name:        "check_control",
+			Description: "Return control messages sent to this session (or to every session) on claude.control since the last check.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string", "description": "Session to check (default: the server's -session)"},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// mcpArguments are the properties the tool schemas in mcpTools advertise;
+// each tool accepts only those in its own schema
+type mcpArguments struct {
+	Message    string `json:"message"`
+	State      string `json:"state"`
+	UserPrompt string `json:"user_prompt"`
+	TaskNum    string `json:"task_num"`
+	SessionID  string `json:"session_id"`
+	ID         string `json:"id"`
+}
+
+// controlMessage is a message received on the control subjects
+type controlMessage struct {
+	Subject  string
+	Data     string
+	Received time.Time
+}
+
+// mcpServer serves the clog tools over newline-delimited JSON-RPC
+type mcpServer struct {
+	contextName string
+	session     string // default session_id for tool calls
+
+	sinks      *sinkSet // opened on the first call that needs them
+	controlErr error    // why control messages cannot be received, if so
+
+	mu      sync.Mutex
+	control []controlMessage
+}
+
+// runMCP runs a Model Context Protocol server on stdin and stdout
+func runMCP(args []string) int {
+	fs := flag.NewFlagSet("mcp", flag.ContinueOnError)
+	sessionFlag := fs.String("session", "", "Default session_id for tool calls")
+	contextFlag := fs.String("context", "", "NATS CLI context name")
+	if err := fs.Parse(args); err != nil {
+		return exitInvalidArgs
+	}
+
+	srv := &mcpServer{contextName: *contextFlag, session: *sessionFlag}
+	defer srv.close()
+	if err := srv.serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "500 Internal Server Error: %v\n", err)
+		return exitInvalidArgs
+	}
+	return exitSuccess
+}
+
+// serve answers requests from r on w until r is closed
+func (s *mcpServer) serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), mcpMaxMessage)
+	out := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if resp := s.handle(ctx, line); resp != nil {
+			if err := out.Encode(resp); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// handle answers one JSON-RPC message, returning nil for notifications
+func (s *mcpServer) handle(ctx context.Context, line []byte) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return rpcFailure(json.RawMessage("null"), rpcParseError, "parse error: "+err.Error())
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(req.ID, rpcInvalidRequest, "invalid JSON-RPC 2.0 request")
+	}
+	if len(req.ID) == 0 {
+		return nil // notifications, such as notifications/initialized, need no reply
+	}
+
+	switch req.Method {
+	case "initialize":
+		return rpcResult(req.ID, map[string]any{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]string{"name": "clog", "version": version},
+			"instructions":    "Log tasks, questions, progress and sessions with these tools instead of running clog in a shell.",
+		})
+	case "ping":
+		return rpcResult(req.ID, map[string]any{})
+	case "tools/list":
+		return rpcResult(req.ID, map[string]any{"tools": mcpTools()})
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return rpcFailure(req.ID, rpcInvalidParams, "invalid tools/call params: "+err.Error())
+		}
+		for _, tool := range mcpTools() {
+			if tool.Name == params.Name {
+				text, ok := s.call(ctx, tool, params.Arguments)
+				return rpcResult(req.ID, map[string]any{
+					"content": []map[string]string{{"type": "text", "text": text}},
+					"isError": !ok,
+				})
+			}
+		}
+		return rpcFailure(req.ID, rpcInvalidParams, fmt.Sprintf("unknown tool '%s'", params.Name))
+	}
+	return rpcFailure(req.ID, rpcMethodNotFound, fmt.Sprintf("method '%s' not found", req.Method))
+}
+
+// call runs a tool and returns its text output and whether it succeeded. The
+// text reads like the CLI's output: a status line, then reminders.
+func (s *mcpServer) call(ctx context.Context, tool mcpTool, arguments json.RawMessage) (string, bool) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	// Only the tool's own properties are allowed, as its schema says
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(arguments, &fields); err != nil {
+		return fmt.Sprintf("400 Bad Request: invalid arguments: %v", err), false
+	}
+	properties, _ := tool.InputSchema["properties"].(map[string]any)
+	for name := range fields {
+		if _, ok := properties[name]; !ok {
+			return fmt.Sprintf("400 Bad Request: invalid arguments: unknown field %q for %s", name, tool.Name), false
+		}
+	}
+	var args mcpArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return fmt.Sprintf("400 Bad Request: invalid arguments: %v", err), false
+	}
+	if args.SessionID == "" {
+		args.SessionID = s.session
+	}
+
+	if tool.Name == "check_control" {
+		return s.checkControl(ctx, args.SessionID)
+	}
+
+	event := clog.Event{
+		Type:       tool.eventType,
+		State:      args.State,
+		Message:    args.Message,
+		UserPrompt: args.UserPrompt,
+		TaskNum:    args.TaskNum,
+		SessionID:  args.SessionID,
+		ID:         args.ID,
+		Timestamp:  time.Now(),
+	}
+	if tool.state != "" {
+		event.State = tool.state
+	}
+	if err := event.Validate(); err != nil {
+		return fmt.Sprintf("400 Bad Request: %v", err), false
+	}
+	if event.State != "" && !validState(event.Type, event.State) {
+		return fmt.Sprintf("400 Bad Request: invalid state '%s' for %s. Must be: %s", event.State, event.Type, strings.Join(clog.ValidStates(event.Type), "|")), false
+	}
+
+	sinks, err := s.openSinks()
+	if err != nil {
+		status, _ := connectionFailure(err)
+		return fmt.Sprintf("%s: %v", status, err), false
+	}
+	sinks.warnings, sinks.dropped = nil, nil
+	if err := sinks.Publish(ctx, event); err != nil {
+		status, _ := publishFailure(err)
+		return fmt.Sprintf("%s: %v", status, err), false
+	}
+
+	warnings := append([]string{clog.ExpiryReminder(sinks.claims, time.Now())}, sinks.dropped...)
+	warnings = append(warnings, sinks.warnings...)
+	return strings.Join(append([]string{"200 OK"}, reminderLines(event, warnings...)...), "\n"), true
+}
+
+// validState reports whether state means something for eventType
+func validState(eventType, state string) bool {
+	for _, valid := range clog.ValidStates(eventType) {
+		if state == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// openSinks opens the configured sinks once and, with a NATS connection,
+// starts collecting control messages. A failure is retried on the next call.
+func (s *mcpServer) openSinks() (*sinkSet, error) {
+	if s.sinks != nil {
+		return s.sinks, nil
+	}
+	settings, err := clog.ResolveSettings(s.contextName, baked())
+	if err != nil {
+		return nil, err
+	}
+	specs, _, err := clog.SinkOptions(settings)
+	if err != nil {
+		return nil, err
+	}
+	if hasSink(specs, clog.SinkStdout) {
+		return nil, fmt.Errorf("%w: the stdout sink cannot be used with 'clog mcp', which answers on stdout", clog.ErrInvalidConfig)
+	}
+	sinks, err := openSinks(settings)
+	if err != nil {
+		return nil, err
+	}
+	s.sinks = sinks
+
+	if sinks.nc != nil {
+		// Subscription failures show up in check_control rather than
+		// breaking publishing
+		_, err := sinks.nc.Subscribe(controlSubject, s.receiveControl)
+		if err == nil {
+			_, err = sinks.nc.Subscribe(controlSubject+".>", s.receiveControl)
+		}
+		s.controlErr = err
+	}
+	return sinks, nil
+}
+
+// receiveControl buffers a control message until check_control collects it,
+// decompressing it if it was sent compressed
+func (s *mcpServer) receiveControl(msg *nats.Msg) {
+	data, err := clog.MsgData(msg)
+	if err != nil {
+		data = []byte(fmt.Sprintf("(unreadable message: %v)", err))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.control = append(s.control, controlMessage{Subject: msg.Subject, Data: string(data), Received: time.Now()})
+}
+
+// checkControl returns and forgets the control messages for a session
+func (s *mcpServer) checkControl(ctx context.Context, session string) (string, bool) {
+	sinks, err := s.openSinks()
+	if err != nil {
+		status, _ := connectionFailure(err)
+		return fmt.Sprintf("%s: %v", status, err), false
+	}
+	if sinks.nc == nil {
+		return "No control channel: NATS is not one of the configured sinks", true
+	}
+	if s.controlErr != nil {
+		return fmt.Sprintf("503 Service Unavailable: cannot subscribe to %s: %v", controlSubject, s.controlErr), false
+	}
+
+	// Anything already sent to the server arrives before the flush completes
+	ctx, cancel := context.WithTimeout(ctx, mcpFlushTimeout)
+	defer cancel()
+	if err := sinks.nc.FlushWithContext(ctx); err != nil {
+		return fmt.Sprintf("503 Service Unavailable: %v", err), false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var (
+		lines []string
+		kept  []controlMessage
+	)
+	for _, msg := range s.control {
+		if session != "" && msg.Subject != controlSubject && msg.Subject != controlSubject+"."+session {
+			kept = append(kept, msg)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s", msg.Received.Format(time.TimeOnly), msg.Subject, msg.Data))
+	}
+	s.control = kept
+
+	if len(lines) == 0 {
+		return "No control messages", true
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+// close closes the sinks, if they were opened
+func (s *mcpServer) close() {
+	if s.sinks != nil {
+		s.sinks.Close()
+	}
+}
+
+func rpcResult(id json.RawMessage, result any) *rpcResponse {
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Result: result}
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) *rpcResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
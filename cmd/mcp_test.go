@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davedotdev/clog"
+	"github.com/nats-io/nats.go"
+)
+
+// mcpResult is the part of a tools/call result the tests check
+type mcpResult struct {
+	Content []struct {
+		Text string `json:"text"`
+	} `json:"content"`
+	IsError bool `json:"isError"`
+}
+
+// serveMCP sends requests to a server and returns its responses by ID
+func serveMCP(t *testing.T, srv *mcpServer, requests ...string) map[string]json.RawMessage {
+	t.Helper()
+	var out strings.Builder
+	if err := srv.serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("serve() error = %v", err)
+	}
+
+	responses := map[string]json.RawMessage{}
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var resp struct {
+			ID     json.RawMessage `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatalf("response %s is not JSON: %v", scanner.Text(), err)
+		}
+		if resp.Error != nil {
+			responses[string(resp.ID)] = resp.Error
+		} else {
+			responses[string(resp.ID)] = resp.Result
+		}
+	}
+	return responses
+}
+
+func TestMCPProtocol(t *testing.T) {
+	isolateSettings(t)
+	srv := &mcpServer{}
+	defer srv.close()
+
+	responses := serveMCP(t, srv,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"nope"}}`,
+		`not json`,
+	)
+	if len(responses) != 5 {
+		t.Fatalf("got %d responses, want 5 (none for the notification): %s", len(responses), responses)
+	}
+	if !strings.Contains(string(responses["1"]), `"protocolVersion":"2024-11-05"`) {
+		t.Errorf("initialize = %s", responses["1"])
+	}
+
+	var list struct {
+		Tools []mcpTool `json:"tools"`
+	}
+	if err := json.Unmarshal(responses["2"], &list); err != nil {
+		t.Fatalf("tools/list = %s: %v", responses["2"], err)
+	}
+	names := map[string]map[string]any{}
+	for _, tool := range list.Tools {
+		names[tool.Name] = tool.InputSchema
+	}
+	for _, name := range []string{"log_task", "ask_question", "report_progress", "start_session", "end_session", "check_control"} {
+		if names[name] == nil {
+			t.Errorf("tools/list is missing %s", name)
+		}
+	}
+	state, _ := names["log_task"]["properties"].(map[string]any)["state"].(map[string]any)
+	if enum, _ := state["enum"].([]any); len(enum) != len(clog.ValidStates("task")) {
+		t.Errorf("log_task state schema = %v, want the task states", state)
+	}
+
+	for id, code := range map[string]string{"3": "-32601", "4": "-32602", "null": "-32700"} {
+		if !strings.Contains(string(responses[id]), `"code":`+code) {
+			t.Errorf("response %s = %s, want error %s", id, responses[id], code)
+		}
+	}
+}
+
+func TestMCPToolCalls(t *testing.T) {
+	isolateSettings(t)
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	t.Setenv("CLOG_SINKS", "file:"+file)
+	srv := &mcpServer{session: "mcp-session"}
+	defer srv.close()
+
+	tests := []struct {
+		name      string
+		call      string
+		wantError bool
+		wantText  string
+		wantEvent string
+	}{
+		{name: "start session", call: `{"name":"start_session","arguments":{"message":"API work"}}`, wantText: "200 OK", wantEvent: "claude.session.started"},
+		{name: "log task with reminder", call: `{"name":"log_task","arguments":{"message":"Adding VAT","state":"in_progress","user_prompt":"Add VAT"}}`, wantText: "Remember: Log completion", wantEvent: "claude.tasks.started"},
+		{name: "blocking question", call: `{"name":"ask_question","arguments":{"message":"Inclusive?","state":"blocked"}}`, wantText: "200 OK", wantEvent: "claude.questions.waiting"},
+		{name: "end session", call: `{"name":"end_session","arguments":{"message":"Done"}}`, wantText: "200 OK", wantEvent: "claude.session.completed"},
+		{name: "missing message", call: `{"name":"report_progress","arguments":{}}`, wantError: true, wantText: "400 Bad Request"},
+		{name: "state outside the schema", call: `{"name":"log_task","arguments":{"message":"m","state":"done"}}`, wantError: true, wantText: "invalid state 'done'"},
+		{name: "unknown argument", call: `{"name":"report_progress","arguments":{"message":"m","colour":"red"}}`, wantError: true, wantText: "invalid arguments"},
+		{name: "message field outside the schema", call: `{"name":"report_progress","arguments":{"message":"m","seq":7}}`, wantError: true, wantText: "unknown field \"seq\""},
+		{name: "privacy cannot be claimed", call: `{"name":"log_task","arguments":{"message":"m","state":"completed","privacy":"hash"}}`, wantError: true, wantText: "unknown field \"privacy\""},
+		{name: "state on a tool without one", call: `{"name":"start_session","arguments":{"message":"m","state":"completed"}}`, wantError: true, wantText: "unknown field \"state\""},
+		{name: "session_id on control only", call: `{"name":"check_control","arguments":{"message":"m"}}`, wantError: true, wantText: "unknown field \"message\""},
+		{name: "control without NATS", call: `{"name":"check_control","arguments":{}}`, wantText: "No control channel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := os.ReadFile(file)
+			responses := serveMCP(t, srv, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":`+tt.call+`}`)
+
+			var result mcpResult
+			if err := json.Unmarshal(responses["1"], &result); err != nil || len(result.Content) != 1 {
+				t.Fatalf("tools/call = %s: %v", responses["1"], err)
+			}
+			if result.IsError != tt.wantError || !strings.Contains(result.Content[0].Text, tt.wantText) {
+				t.Errorf("tools/call = %+v, want isError %v and %q", result, tt.wantError, tt.wantText)
+			}
+
+			after, _ := os.ReadFile(file)
+			added := strings.TrimSpace(strings.TrimPrefix(string(after), string(before)))
+			if tt.wantEvent == "" {
+				if added != "" {
+					t.Errorf("published %s, want nothing", added)
+				}
+				return
+			}
+			var msg clog.Message
+			if err := json.Unmarshal([]byte(added), &msg); err != nil {
+				t.Fatalf("published %q: %v", added, err)
+			}
+			if msg.Event != tt.wantEvent || msg.SessionID != "mcp-session" {
+				t.Errorf("published %+v, want %s for mcp-session", msg, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestMCPCheckControl(t *testing.T) {
+	isolateSettings(t)
+	url := startTestServer(t, false)
+	t.Setenv("NATS_URL", url)
+
+	srv := &mcpServer{session: "s1"}
+	defer srv.close()
+	// The first call connects and subscribes
+	serveMCP(t, srv, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"check_control"}}`)
+
+	nc, err := nats.Connect(url)
+	if err != nil {
+		t.Fatalf("nats.Connect() error = %v", err)
+	}
+	defer nc.Close()
+	for subject, data := range map[string]string{"claude.control": "pause all", "claude.control.s1": "stop s1", "claude.control.s2": "stop s2"} {
+		nc.Publish(subject, []byte(data))
+	}
+	// Compressed messages are decompressed
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("resume s1 after review"))
+	gz.Close()
+	msg := nats.NewMsg("claude.control.s1")
+	msg.Header.Set(clog.ContentEncodingHeader, clog.EncodingGzip)
+	msg.Data = compressed.Bytes()
+	nc.PublishMsg(msg)
+	nc.Flush()
+
+	responses := serveMCP(t, srv,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"check_control"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"check_control"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"check_control","arguments":{"session_id":"s2"}}}`,
+	)
+	text := func(id string) string {
+		var result mcpResult
+		if err := json.Unmarshal(responses[id], &result); err != nil || len(result.Content) != 1 {
+			t.Fatalf("tools/call = %s: %v", responses[id], err)
+		}
+		return result.Content[0].Text
+	}
+	if got := text("1"); !strings.Contains(got, "pause all") || !strings.Contains(got, "stop s1") || !strings.Contains(got, "resume s1 after review") || strings.Contains(got, "stop s2") {
+		t.Errorf("check_control for s1 = %q", got)
+	}
+	if got := text("2"); got != "No control messages" {
+		t.Errorf("second check_control = %q, want messages to be collected once", got)
+	}
+	if got := text("3"); !strings.Contains(got, "stop s2") {
+		t.Errorf("check_control for s2 = %q", got)
+	}
+}
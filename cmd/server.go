@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// JetStream stream that keeps clog events when the embedded server runs
+// with -jetstream
+const (
+	clogStream        = "CLOG"
+	clogStreamSubject = "claude.>"
+)
+
+// How long to wait for the embedded server to accept connections
+const serverStartTimeout = 5 * time.Second
+
+// embeddedOptions configures the embedded nats-server
+type embeddedOptions struct {
+	Host      string
+	Port      int
+	JetStream bool
+	StoreDir  string
+	Verbose   bool
+}
+
+// runServer runs an embedded nats-server until interrupted
+func runServer(args []string) int {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	hostFlag := fs.String("host", "127.0.0.1", "Address to listen on")
+	portFlag := fs.Int("port", 4222, "Port to listen on")
+	jetStreamFlag := fs.Bool("jetstream", false, "Enable JetStream and keep events in the "+clogStream+" stream")
+	storeDirFlag := fs.String("store-dir", "", "JetStream store directory (implies -jetstream; default: ~/.local/share/clog/jetstream)")
+	verboseFlag := fs.Bool("v", false, "Log server activity to stderr")
+	if err := fs.Parse(args); err != nil {
+		return exitInvalidArgs
+	}
+
+	opts := embeddedOptions{
+		Host:      *hostFlag,
+		Port:      *portFlag,
+		JetStream: *jetStreamFlag || *storeDirFlag != "",
+		StoreDir:  *storeDirFlag,
+		Verbose:   *verboseFlag,
+	}
+	if opts.JetStream && opts.StoreDir == "" {
+		dir, err := defaultStoreDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "400 Bad Request: %v (use -store-dir)\n", err)
+			return exitInvalidArgs
+		}
+		opts.StoreDir = dir
+	}
+
+	ns, err := startEmbeddedServer(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "503 Service Unavailable: %v\n", err)
+		return exitConnectionError
+	}
+
+	fmt.Printf("200 OK: nats-server %s listening on %s\n", server.VERSION, ns.ClientURL())
+	if opts.JetStream {
+		fmt.Printf("  JetStream: stream %s (%s) stored in %s\n", clogStream, clogStreamSubject, opts.StoreDir)
+	}
+	fmt.Printf("  In another shell: export NATS_URL=%s\n", ns.ClientURL())
+	fmt.Println("  Press Ctrl+C to stop")
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	<-sigs
+
+	ns.Shutdown()
+	ns.WaitForShutdown()
+	return exitSuccess
+}
+
+// startEmbeddedServer starts nats-server in-process and, with JetStream,
+// makes sure the clog stream exists
+func startEmbeddedServer(opts embeddedOptions) (*server.Server, error) {
+	ns, err := server.NewServer(&server.Options{
+		Host:      opts.Host,
+		Port:      opts.Port,
+		JetStream: opts.JetStream,
+		StoreDir:  opts.StoreDir,
+		NoSigs:    true,
+		NoLog:     !opts.Verbose,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("configuring embedded server: %w", err)
+	}
+	if opts.Verbose {
+		ns.ConfigureLogger()
+	}
+
+	go ns.Start()
+	if !ns.ReadyForConnections(serverStartTimeout) {
+		ns.Shutdown()
+		return nil, fmt.Errorf("embedded server not ready after %s (is %s:%d in use?)", serverStartTimeout, opts.Host, opts.Port)
+	}
+
+	if opts.JetStream {
+		if err := ensureStream(ns); err != nil {
+			ns.Shutdown()
+			return nil, err
+		}
+	}
+	return ns, nil
+}
+
+// ensureStream creates the clog stream on the embedded server if needed
+func ensureStream(ns *server.Server) error {
+	nc, err := nats.Connect("", nats.InProcessServer(ns))
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		return err
+	}
+
+	_, err = js.StreamInfo(clogStream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     clogStream,
+			Subjects: []string{clogStreamSubject},
+			Storage:  nats.FileStorage,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("creating stream %s: %w", clogStream, err)
+	}
+	return nil
+}
+
+// defaultStoreDir returns the JetStream store used when -store-dir is unset
+func defaultStoreDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "clog", "jetstream"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "clog", "jetstream"), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/davedotdev/clog"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// startTestServer runs an embedded nats-server on a random port for the
+// duration of a test and returns its client URL
+func startTestServer(t *testing.T, jetStream bool) string {
+	t.Helper()
+	opts := embeddedOptions{Host: "127.0.0.1", Port: server.RANDOM_PORT, JetStream: jetStream}
+	if jetStream {
+		opts.StoreDir = t.TempDir()
+	}
+
+	ns, err := startEmbeddedServer(opts)
+	if err != nil {
+		t.Fatalf("startEmbeddedServer() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	})
+	return ns.ClientURL()
+}
+
+func TestEmbeddedServerJetStream(t *testing.T) {
+	isolateSettings(t)
+	t.Setenv("NATS_URL", startTestServer(t, true))
+
+	nc, _, err := connectNATS("")
+	if err != nil {
+		t.Fatalf("connectNATS() error = %v", err)
+	}
+	defer nc.Close()
+
+	event := clog.Event{Type: "task", State: "in_progress", Message: "hi"}
+	if err := clog.NewNATSPublisher(nc, nil).Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("nc.JetStream() error = %v", err)
+	}
+	msg, err := js.GetLastMsg(clogStream, "claude.tasks.started")
+	if err != nil {
+		t.Fatalf("GetLastMsg() error = %v", err)
+	}
+	var stored clog.Message
+	if err := json.Unmarshal(msg.Data, &stored); err != nil || stored.Message != "hi" {
+		t.Errorf("stored message = %s", msg.Data)
+	}
+}
+
+func TestEnsureStreamIdempotent(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		ns, err := startEmbeddedServer(embeddedOptions{Host: "127.0.0.1", Port: server.RANDOM_PORT, JetStream: true, StoreDir: dir})
+		if err != nil {
+			t.Fatalf("startEmbeddedServer() run %d error = %v", i, err)
+		}
+		if err := ensureStream(ns); err != nil {
+			t.Errorf("ensureStream() run %d error = %v", i, err)
+		}
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/davedotdev/clog"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+)
+
+// sinkSet is the publisher for the configured sinks plus what the CLI needs
+// to report on them
+type sinkSet struct {
+	publisher clog.Publisher
+	nc        *nats.Conn
+	claims    *jwt.UserClaims
+	warnings  []string
+	dropped   []string // why an event was not published (yet)
+}
+
+// openSinks builds the configured sinks, connecting to NATS only when it is
+// one of them, and wraps them in layers that each event passes through in
+// this order:
+//
+//  1. Privacy drops or hashes the prompt, so no later layer sees it.
+//  2. Redact removes secrets before anything can publish, hold or log them.
+//  3. Dedupe drops repeats before they count against a rate limit.
+//  4. RateLimit drops or holds events before they use up a sequence number.
+//  5. Sequence numbers the event, so every sink records the same number.
+//  6. Attachment uploads files, so the audit log lists the object names.
+//  7. Audit records the outcome of every sink.
+//  8. Trace updates the session's spans once the sinks accept the event.
+//
+// When NATS is the only sink and nothing is audited, a failed connection is
+// returned straight away; otherwise it becomes that sink's publish error and
+// the sink policy decides the outcome.
+func openSinks(s clog.Settings) (*sinkSet, error) {
+	specs, policy, err := clog.SinkOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	auditLog, err := clog.AuditLogOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	format, err := clog.FormatOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := clog.CompressionOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	traceEndpoint, err := clog.TraceOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	sequence, err := clog.SequenceOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	dedupe, dedupeMode, err := clog.DedupeOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	limits, limitMode, err := clog.RateLimitOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	redactRules, err := clog.RedactOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	privacy, salt, err := clog.PrivacyOptions(s)
+	if err != nil {
+		return nil, err
+	}
+	if sequence == clog.SequenceKV && !hasSink(specs, clog.SinkNATS) {
+		return nil, fmt.Errorf("%w: sequence 'kv' needs the nats sink", clog.ErrInvalidConfig)
+	}
+
+	set := &sinkSet{}
+	var sinks []clog.Sink
+	for _, spec := range specs {
+		switch spec.Kind {
+		case clog.SinkNATS:
+			if set.nc != nil {
+				continue
+			}
+			nc, claims, err := clog.Connect(s)
+			if err != nil {
+				if len(specs) == 1 && auditLog == nil {
+					return nil, err
+				}
+				sinks = append(sinks, clog.Sink{Name: spec.String(), Publisher: failedSink{err}})
+				continue
+			}
+			set.nc, set.claims = nc, claims
+			publisher := clog.NewNATSPublisher(nc, claims)
+			publisher.Format = format
+			publisher.Compression = compression
+			sinks = append(sinks, clog.Sink{Name: spec.String(), Publisher: publisher})
+		case clog.SinkStdout:
+			publisher := clog.NewWriterPublisher(os.Stdout)
+			publisher.Format = format
+			sinks = append(sinks, clog.Sink{Name: spec.String(), Publisher: publisher})
+		case clog.SinkFile:
+			publisher := clog.NewFilePublisher(spec.Target)
+			publisher.Format = format
+			sinks = append(sinks, clog.Sink{Name: spec.String(), Publisher: publisher})
+		case clog.SinkHTTP:
+			publisher := clog.NewHTTPPublisher(spec.Target, nil)
+			publisher.Format = format
+			publisher.Compression = compression
+			sinks = append(sinks, clog.Sink{Name: spec.String(), Publisher: publisher})
+		}
+	}
+
+	multi := clog.NewMultiPublisher(policy, sinks...)
+	multi.OnError = func(err *clog.SinkError) {
+		set.warnings = append(set.warnings, fmt.Sprintf("Warning: %v", err))
+	}
+	set.publisher = multi
+
+	// Layers are wrapped from the sinks outwards, so from 8 back to 1
+	if traceEndpoint != "" {
+		tracer := clog.NewTracePublisher(set.publisher, traceEndpoint)
+		tracer.OnError = func(err error) {
+			set.warnings = append(set.warnings, fmt.Sprintf("Warning: trace not exported: %v", err))
+		}
+		set.publisher = tracer
+	}
+	if auditLog != nil {
+		audit := clog.NewAuditPublisher(set.publisher, auditLog, set.claims)
+		audit.OnError = func(err error) {
+			set.warnings = append(set.warnings, fmt.Sprintf("Warning: audit log %s not written: %v", auditLog.Path(), err))
+		}
+		set.publisher = audit
+	}
+
+	// Files are redacted with the same rules as the message
+	attacher := clog.NewAttachmentPublisher(set.publisher, set.nc)
+	attacher.Rules = redactRules
+	attacher.OnRedact = func(path string, counts map[string]int) {
+		set.warnings = append(set.warnings, fmt.Sprintf("Redacted from %s before uploading: %s", path, clog.RedactionSummary(counts)))
+	}
+	set.publisher = attacher
+
+	var sequencer clog.Sequencer
+	switch sequence {
+	case clog.SequenceLocal:
+		sequencer = clog.NewLocalSequencer("")
+	case clog.SequenceKV:
+		sequencer = clog.NewKVSequencer(set.nc)
+	}
+	if sequencer != nil {
+		numbered := clog.NewSequencePublisher(set.publisher, sequencer)
+		numbered.OnError = func(err error) {
+			set.warnings = append(set.warnings, fmt.Sprintf("Warning: published without a sequence number: %v", err))
+		}
+		set.publisher = numbered
+	}
+
+	if len(limits) > 0 {
+		limiter := clog.NewRateLimitPublisher(set.publisher, limits, limitMode)
+		limiter.OnLimited = func(e clog.Event, limit clog.RateLimit, held bool) {
+			if held {
+				set.dropped = append(set.dropped, fmt.Sprintf("Rate limited (%s): not published yet; the latest held-back %s event goes out with the next clog call once the limit allows", limit, e.Type))
+				return
+			}
+			set.dropped = append(set.dropped, fmt.Sprintf("Rate limited (%s): this %s event was dropped", limit, e.Type))
+		}
+		limiter.OnError = func(err error) {
+			set.warnings = append(set.warnings, fmt.Sprintf("Warning: rate limit: %v", err))
+		}
+		set.publisher = limiter
+	}
+	if dedupe != nil {
+		deduped := clog.NewDedupePublisher(set.publisher, dedupe, dedupeMode)
+		deduped.OnDuplicate = func(id string, at time.Time) {
+			set.dropped = append(set.dropped, fmt.Sprintf("Duplicate of message %s published %s ago; not published again", id, time.Since(at).Round(time.Millisecond)))
+		}
+		deduped.OnError = func(err error) {
+			set.warnings = append(set.warnings, fmt.Sprintf("Warning: dedupe cache: %v", err))
+		}
+		set.publisher = deduped
+	}
+
+	if len(redactRules) > 0 {
+		redactor := clog.NewRedactPublisher(set.publisher, redactRules)
+		redactor.OnRedact = func(counts map[string]int) {
+			set.warnings = append(set.warnings, fmt.Sprintf("Redacted before publishing: %s", clog.RedactionSummary(counts)))
+		}
+		set.publisher = redactor
+	}
+	if privacy != clog.PrivacyOff {
+		set.publisher = clog.NewPrivacyPublisher(set.publisher, privacy, salt)
+	}
+	return set, nil
+}
+
+// hasSink reports whether specs include a sink of the given kind
+func hasSink(specs []clog.SinkSpec, kind string) bool {
+	for _, spec := range specs {
+		if spec.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// failedSink stands in for a sink that could not be opened
+type failedSink struct {
+	err error
+}
+
+func (f failedSink) Publish(context.Context, clog.Event) error {
+	return f.err
+}
+
+// Publish sends the event to every sink
+func (s *sinkSet) Publish(ctx context.Context, e clog.Event) error {
+	return s.publisher.Publish(ctx, e)
+}
+
+// Close closes the NATS connection, if one was opened
+func (s *sinkSet) Close() {
+	if s.nc != nil {
+		s.nc.Close()
+	}
+}
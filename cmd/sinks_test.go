@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/davedotdev/clog"
+)
+
+func TestOpenSinks(t *testing.T) {
+	tests := []struct {
+		name         string
+		sinks        string
+		policy       string
+		wantOpenErr  bool
+		wantErr      bool
+		wantWarnings int
+		wantLines    int
+	}{
+		{name: "file only never connects", sinks: "file:{file}", wantLines: 1},
+		{name: "unreachable nats alone", sinks: "nats", wantOpenErr: true},
+		{name: "unreachable nats with all policy", sinks: "nats,file:{file}", wantErr: true, wantWarnings: 1, wantLines: 1},
+		{name: "unreachable nats with any policy", sinks: "nats,file:{file}", policy: "any", wantWarnings: 1, wantLines: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateSettings(t)
+			file := filepath.Join(t.TempDir(), "events.jsonl")
+			t.Setenv("NATS_URL", "nats://127.0.0.1:1")
+			t.Setenv("CLOG_SINKS", strings.ReplaceAll(tt.sinks, "{file}", file))
+			t.Setenv("CLOG_SINK_POLICY", tt.policy)
+
+			s, err := clog.ResolveSettings("", baked())
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+			sinks, err := openSinks(s)
+			if tt.wantOpenErr {
+				if err == nil {
+					sinks.Close()
+					t.Fatal("openSinks() should fail")
+				}
+				if _, code := connectionFailure(err); code != exitConnectionError {
+					t.Errorf("connectionFailure() code = %d, want %d", code, exitConnectionError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("openSinks() error = %v", err)
+			}
+			defer sinks.Close()
+
+			err = sinks.Publish(context.Background(), clog.Event{Type: "progress", Message: "50% complete"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if _, code := publishFailure(err); code != exitConnectionError {
+					t.Errorf("publishFailure() code = %d, want %d", code, exitConnectionError)
+				}
+			}
+			if len(sinks.warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", sinks.warnings, tt.wantWarnings)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("os.ReadFile() error = %v", err)
+			}
+			if lines := strings.Count(string(data), "\n"); lines != tt.wantLines {
+				t.Errorf("file has %d lines, want %d", lines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestOpenSinksSequence(t *testing.T) {
+	isolateSettings(t)
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	t.Setenv("CLOG_SINKS", "file:"+file)
+
+	s, err := clog.ResolveSettings("", baked())
+	if err != nil {
+		t.Fatalf("ResolveSettings() error = %v", err)
+	}
+	sinks, err := openSinks(s)
+	if err != nil {
+		t.Fatalf("openSinks() error = %v", err)
+	}
+	defer sinks.Close()
+
+	for i, session := range []string{"s1", "s1", "s2", ""} {
+		if err := sinks.Publish(context.Background(), clog.Event{Type: "progress", Message: fmt.Sprintf("step %d", i), SessionID: session}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("os.ReadFile() error = %v", err)
+	}
+	var seqs []uint64
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var msg clog.Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		seqs = append(seqs, msg.Seq)
+	}
+	if want := []uint64{1, 2, 1, 0}; !slices.Equal(seqs, want) {
+		t.Errorf("seqs = %v, want %v", seqs, want)
+	}
+
+	// The kv source needs NATS
+	t.Setenv("CLOG_SEQUENCE", "kv")
+	s, err = clog.ResolveSettings("", baked())
+	if err != nil {
+		t.Fatalf("ResolveSettings() error = %v", err)
+	}
+	if _, err := openSinks(s); !errors.Is(err, clog.ErrInvalidConfig) {
+		t.Errorf("openSinks() error = %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestOpenSinksDedupe(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		window      string
+		events      []clog.Event
+		wantLines   int
+		wantDropped int
+	}{
+		{
+			name:      "repeat without an ID kept",
+			events:    []clog.Event{{Type: "progress", Message: "m", SessionID: "s1"}, {Type: "progress", Message: "m", SessionID: "s1"}},
+			wantLines: 2,
+		},
+		{
+			name:        "exact repeat dropped by content",
+			mode:        "content",
+			events:      []clog.Event{{Type: "progress", Message: "m", SessionID: "s1"}, {Type: "progress", Message: "m", SessionID: "s1"}},
+			wantLines:   1,
+			wantDropped: 1,
+		},
+		{
+			name:      "different events kept",
+			mode:      "content",
+			events:    []clog.Event{{Type: "progress", Message: "m", SessionID: "s1"}, {Type: "progress", Message: "m", SessionID: "s2"}},
+			wantLines: 2,
+		},
+		{
+			name:      "repeated task and question kept by content",
+			mode:      "content",
+			events:    []clog.Event{{Type: "task", State: "completed", Message: "Task completed", SessionID: "s1"}, {Type: "task", State: "completed", Message: "Task completed", SessionID: "s1"}, {Type: "question", State: "blocked", Message: "Proceed?"}, {Type: "question", State: "blocked", Message: "Proceed?"}},
+			wantLines: 4,
+		},
+		{
+			name:        "idempotency key repeat dropped",
+			events:      []clog.Event{{ID: "retry-1", Type: "progress", Message: "first try"}, {ID: "retry-1", Type: "progress", Message: "second try"}},
+			wantLines:   1,
+			wantDropped: 1,
+		},
+		{
+			name:      "dedupe off",
+			mode:      "off",
+			events:    []clog.Event{{ID: "retry-1", Type: "progress", Message: "m"}, {ID: "retry-1", Type: "progress", Message: "m"}},
+			wantLines: 2,
+		},
+		{
+			name:      "zero window",
+			mode:      "content",
+			window:    "0",
+			events:    []clog.Event{{Type: "progress", Message: "m"}, {Type: "progress", Message: "m"}},
+			wantLines: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateSettings(t)
+			file := filepath.Join(t.TempDir(), "events.jsonl")
+			t.Setenv("CLOG_SINKS", "file:"+file)
+			t.Setenv("CLOG_DEDUPE", tt.mode)
+			t.Setenv("CLOG_DEDUPE_WINDOW", tt.window)
+
+			s, err := clog.ResolveSettings("", baked())
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+			sinks, err := openSinks(s)
+			if err != nil {
+				t.Fatalf("openSinks() error = %v", err)
+			}
+			defer sinks.Close()
+
+			for _, event := range tt.events {
+				if err := sinks.Publish(context.Background(), event); err != nil {
+					t.Fatalf("Publish() error = %v", err)
+				}
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("os.ReadFile() error = %v", err)
+			}
+			if lines := strings.Count(string(data), "\n"); lines != tt.wantLines {
+				t.Errorf("file has %d lines, want %d", lines, tt.wantLines)
+			}
+			if len(sinks.dropped) != tt.wantDropped {
+				t.Errorf("dropped = %q, want %d", sinks.dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestRepeatedTaskAndQuestionCommands(t *testing.T) {
+	isolateSettings(t)
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	t.Setenv("CLOG_SINKS", "file:"+file)
+
+	for _, run := range [][]string{{"task", "done", "-session=s"}, {"task", "done", "-session=s"}, {"ask", "Proceed?"}, {"ask", "Proceed?"}} {
+		if code := runEventCommand(findEventCommand(run[0]), run[1:]); code != exitSuccess {
+			t.Fatalf("clog %v = %d", run, code)
+		}
+	}
+	data, _ := os.ReadFile(file)
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Errorf("published %d events, want 4:\n%s", lines, data)
+	}
+}
+
+func TestDroppedEventReminders(t *testing.T) {
+	isolateSettings(t)
+	t.Setenv("CLOG_SINKS", "file:"+filepath.Join(t.TempDir(), "events.jsonl"))
+	t.Setenv("CLOG_RATE_LIMIT", "progress=1/10s")
+	t.Setenv("CLOG_RATE_LIMIT_MODE", "drop")
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "first progress", args: []string{"-type=progress", "-message=p1", "-session=s"}},
+		{name: "rate limited", args: []string{"-type=progress", "-message=p2", "-session=s"}, want: "Rate limited (progress=1/10s): this progress event was dropped"},
+		{name: "first key", args: []string{"-type=task", "-state=completed", "-message=done", "-idempotency-key=k1"}},
+		{name: "repeated key", args: []string{"-type=task", "-state=completed", "-message=done", "-idempotency-key=k1"}, want: "Duplicate of message k1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var code int
+			out := captureStdout(t, func() { code = runArgs(t, tt.args...) })
+			if code != exitSuccess {
+				t.Fatalf("run() = %d", code)
+			}
+			// The note is part of the reminders an agent reads after 200 OK
+			reminders, ok := strings.CutPrefix(out, "200 OK\n")
+			if !ok {
+				t.Errorf("output = %q, want 200 OK first", out)
+			}
+			if tt.want == "" && strings.Contains(reminders, "not published") {
+				t.Errorf("reminders = %q, want no note", reminders)
+			}
+			if tt.want != "" && !strings.Contains(reminders, "  "+tt.want) {
+				t.Errorf("reminders = %q, want %q", reminders, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenSinksRedact(t *testing.T) {
+	isolateSettings(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "events.jsonl")
+	auditFile := filepath.Join(dir, "audit.jsonl")
+	t.Setenv("CLOG_SINKS", "file:"+file)
+	t.Setenv("CLOG_AUDIT_LOG", auditFile)
+	t.Setenv("CLOG_REDACT_RULES", `ticket=INC-\d+`)
+
+	s, err := clog.ResolveSettings("", baked())
+	if err != nil {
+		t.Fatalf("ResolveSettings() error = %v", err)
+	}
+	sinks, err := openSinks(s)
+	if err != nil {
+		t.Fatalf("openSinks() error = %v", err)
+	}
+	defer sinks.Close()
+
+	event := clog.Event{Type: "task", Message: "Fixing INC-42", UserPrompt: "ping ops@example.com about INC-42"}
+	if err := sinks.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(file)
+	var got clog.Message
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("published %q: %v", data, err)
+	}
+	if got.Message != "Fixing [REDACTED:ticket]" || got.UserPrompt != "ping [REDACTED:email] about [REDACTED:ticket]" || got.Redactions != 3 {
+		t.Errorf("published %+v", got)
+	}
+	if audit, _ := os.ReadFile(auditFile); strings.Contains(string(audit), "ops@example.com") {
+		t.Errorf("audit log holds the unredacted event: %s", audit)
+	}
+	if want := []string{"Redacted before publishing: 1 email, 2 ticket"}; !slices.Equal(sinks.warnings, want) {
+		t.Errorf("warnings = %q, want %q", sinks.warnings, want)
+	}
+}
+
+func TestOpenSinksPrivacy(t *testing.T) {
+	isolateSettings(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "events.jsonl")
+	auditFile := filepath.Join(dir, "audit.jsonl")
+	t.Setenv("CLOG_SINKS", "file:"+file)
+	t.Setenv("CLOG_AUDIT_LOG", auditFile)
+	t.Setenv("CLOG_PRIVACY", "omit")
+
+	s, err := clog.ResolveSettings("", baked())
+	if err != nil {
+		t.Fatalf("ResolveSettings() error = %v", err)
+	}
+	sinks, err := openSinks(s)
+	if err != nil {
+		t.Fatalf("openSinks() error = %v", err)
+	}
+	defer sinks.Close()
+
+	event := clog.Event{Type: "task", Message: "Fixing invoices", UserPrompt: "Confidential: ask ops@example.com"}
+	if err := sinks.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(file)
+	var got clog.Message
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("published %q: %v", data, err)
+	}
+	if got.Privacy != clog.PrivacyOmit || got.UserPrompt != "" || got.Message != "Fixing invoices" {
+		t.Errorf("published %+v", got)
+	}
+	if audit, _ := os.ReadFile(auditFile); strings.Contains(string(audit), "Confidential") {
+		t.Errorf("audit log holds the prompt: %s", audit)
+	}
+	// The prompt is gone before redaction could find anything in it
+	if len(sinks.warnings) != 0 {
+		t.Errorf("warnings = %q, want none", sinks.warnings)
+	}
+}
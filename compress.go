@@ -0,0 +1,141 @@
+package clog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/nats-io/nats.go"
+)
+
+// Encodings accepted in the compression setting and sent in the
+// Content-Encoding header
+const (
+	EncodingGzip = "gzip"
+	EncodingS2   = "s2"
+)
+
+// ContentEncodingHeader names the encoding of a compressed NATS message or
+// HTTP request body
+const ContentEncodingHeader = "Content-Encoding"
+
+// Payloads up to this size are sent uncompressed unless
+// compression_threshold says otherwise
+const defaultCompressionThreshold = 1 << 10
+
+// Longest payload Decompress will produce, so a hostile message cannot
+// exhaust memory
+const maxDecompressedSize = 64 << 20
+
+// Compression compresses payloads bigger than Threshold bytes with Encoding.
+// The zero value sends everything as is.
+type Compression struct {
+	Encoding  string // gzip|s2, or "" for none
+	Threshold int64
+}
+
+// CompressionOptions returns the compression configured by compression
+// (off, gzip or s2) and compression_threshold
+func CompressionOptions(s Settings) (Compression, error) {
+	c := Compression{Encoding: s.Options["compression"].Value, Threshold: defaultCompressionThreshold}
+	switch c.Encoding {
+	case "", "off":
+		return Compression{}, nil
+	case EncodingGzip, EncodingS2:
+	default:
+		return c, fmt.Errorf("%w: invalid compression '%s'. Must be: off|gzip|s2", ErrInvalidConfig, c.Encoding)
+	}
+
+	if value := s.Options["compression_threshold"].Value; value != "" {
+		threshold, err := parseSize(value)
+		if err != nil {
+			return c, fmt.Errorf("%w: compression_threshold: %v", ErrInvalidConfig, err)
+		}
+		c.Threshold = threshold
+	}
+	return c, nil
+}
+
+// apply compresses data if it is over the threshold, recording the encoding
+// in headers
+func (c Compression) apply(data []byte, headers map[string]string) ([]byte, map[string]string, error) {
+	if c.Encoding == "" || int64(len(data)) <= c.Threshold {
+		return data, headers, nil
+	}
+
+	var buf bytes.Buffer
+	switch c.Encoding {
+	case EncodingGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, nil, err
+		}
+	case EncodingS2:
+		buf.Write(s2.Encode(nil, data))
+	}
+	// Not worth it for data that does not shrink
+	if buf.Len() >= len(data) {
+		return data, headers, nil
+	}
+
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headers[ContentEncodingHeader] = c.Encoding
+	return buf.Bytes(), headers, nil
+}
+
+// Decompress returns data decoded from encoding, the value of a message's
+// Content-Encoding header; "" and "identity" return data as is
+func Decompress(encoding string, data []byte) ([]byte, error) {
+	var r io.Reader
+	switch encoding {
+	case "", "identity":
+		return data, nil
+	case EncodingGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip payload: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case EncodingS2:
+		n, err := s2.DecodedLen(data)
+		if err != nil {
+			return nil, fmt.Errorf("s2 payload: %w", err)
+		}
+		if n > maxDecompressedSize {
+			return nil, fmt.Errorf("s2 payload decompresses to %d bytes, more than %d", n, maxDecompressedSize)
+		}
+		decoded, err := s2.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("s2 payload: %w", err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unsupported %s '%s'", ContentEncodingHeader, encoding)
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s payload: %w", encoding, err)
+	}
+	if len(decoded) > maxDecompressedSize {
+		return nil, fmt.Errorf("%s payload decompresses to more than %d bytes", encoding, maxDecompressedSize)
+	}
+	return decoded, nil
+}
+
+// MsgData returns a NATS message's payload, decompressed according to its
+// Content-Encoding header
+func MsgData(msg *nats.Msg) ([]byte, error) {
+	if msg.Header == nil {
+		return msg.Data, nil
+	}
+	return Decompress(msg.Header.Get(ContentEncodingHeader), msg.Data)
+}
@@ -0,0 +1,171 @@
+package clog
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressionOptions(t *testing.T) {
+	tests := []struct {
+		compression string
+		threshold   string
+		want        Compression
+		wantErr     bool
+	}{
+		{want: Compression{}},
+		{compression: "off", threshold: "10K", want: Compression{}},
+		{compression: "gzip", want: Compression{Encoding: EncodingGzip, Threshold: defaultCompressionThreshold}},
+		{compression: "s2", threshold: "4K", want: Compression{Encoding: EncodingS2, Threshold: 4096}},
+		{compression: "zstd", wantErr: true},
+		{compression: "gzip", threshold: "big", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.compression+"/"+tt.threshold, func(t *testing.T) {
+			isolateSettings(t)
+			t.Setenv("CLOG_COMPRESSION", tt.compression)
+			t.Setenv("CLOG_COMPRESSION_THRESHOLD", tt.threshold)
+			s, err := ResolveSettings("", Baked{})
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+
+			got, err := CompressionOptions(s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("CompressionOptions() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("CompressionOptions() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	text := []byte(strings.Repeat("Add VAT breakdown to the invoice API. ", 200))
+	random := make([]byte, 4096)
+	rand.Read(random)
+
+	tests := []struct {
+		name         string
+		compression  Compression
+		data         []byte
+		wantEncoding string
+	}{
+		{name: "gzip", compression: Compression{Encoding: EncodingGzip, Threshold: 1024}, data: text, wantEncoding: EncodingGzip},
+		{name: "s2", compression: Compression{Encoding: EncodingS2, Threshold: 1024}, data: text, wantEncoding: EncodingS2},
+		{name: "under threshold", compression: Compression{Encoding: EncodingGzip, Threshold: 1 << 20}, data: text},
+		{name: "does not shrink", compression: Compression{Encoding: EncodingS2, Threshold: 1024}, data: random},
+		{name: "off", data: text},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, headers, err := tt.compression.apply(tt.data, nil)
+			if err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			if encoding := headers[ContentEncodingHeader]; encoding != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", encoding, tt.wantEncoding)
+			}
+			if tt.wantEncoding != "" && len(data) >= len(tt.data) {
+				t.Errorf("compressed %d bytes to %d", len(tt.data), len(data))
+			}
+
+			decoded, err := Decompress(headers[ContentEncodingHeader], data)
+			if err != nil || !bytes.Equal(decoded, tt.data) {
+				t.Errorf("Decompress() = %d bytes, %v, want the original %d", len(decoded), err, len(tt.data))
+			}
+		})
+	}
+
+	for _, encoding := range []string{EncodingGzip, EncodingS2, "br"} {
+		if _, err := Decompress(encoding, []byte("not compressed")); err == nil {
+			t.Errorf("Decompress(%s) of garbage succeeded", encoding)
+		}
+	}
+}
+
+func TestNATSPublisherCompression(t *testing.T) {
+	nc := connectTestServer(t)
+	sub, err := nc.SubscribeSync("claude.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewNATSPublisher(nc, nil)
+	p.Compression = Compression{Encoding: EncodingS2, Threshold: 1024}
+	prompt := strings.Repeat("Rewrite the invoice module. ", 500)
+	for _, event := range []Event{
+		{Type: "task", Message: "Rewriting", UserPrompt: prompt},
+		{Type: "progress", Message: "small"},
+	} {
+		if err := p.Publish(context.Background(), event); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	for i, want := range []struct {
+		encoding string
+		prompt   string
+	}{{EncodingS2, prompt}, {"", ""}} {
+		msg, err := sub.NextMsg(2 * time.Second)
+		if err != nil {
+			t.Fatalf("NextMsg() error = %v", err)
+		}
+		if encoding := msg.Header.Get(ContentEncodingHeader); encoding != want.encoding {
+			t.Errorf("message %d Content-Encoding = %q, want %q", i, encoding, want.encoding)
+		}
+		data, err := MsgData(msg)
+		if err != nil {
+			t.Fatalf("MsgData() error = %v", err)
+		}
+		var got Message
+		if err := json.Unmarshal(data, &got); err != nil || got.UserPrompt != want.prompt {
+			t.Errorf("message %d = %+v, %v", i, got, err)
+		}
+	}
+}
+
+func TestHTTPPublisherCompression(t *testing.T) {
+	var (
+		encoding string
+		body     []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get(ContentEncodingHeader)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPublisher(srv.URL, nil)
+	p.Compression = Compression{Encoding: EncodingGzip, Threshold: 100}
+	event := Event{Type: "task", Message: strings.Repeat("Rewriting invoices. ", 20)}
+	if err := p.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if encoding != EncodingGzip {
+		t.Fatalf("Content-Encoding = %q, want gzip", encoding)
+	}
+	data, err := Decompress(encoding, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Message
+	if err := json.Unmarshal(data, &got); err != nil || got.Message != event.Message {
+		t.Errorf("posted %+v, %v", got, err)
+	}
+}
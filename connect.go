@@ -0,0 +1,224 @@
+package clog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// ErrInvalidCredentials marks credentials that could not be turned into a
+// NATS auth option, so they are never silently replaced by no authentication
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Connect opens a NATS connection with resolved settings. For JWT-based
+// credentials it also returns the decoded user claims.
+func Connect(s Settings) (*nats.Conn, *jwt.UserClaims, error) {
+	opts, err := authOptions(s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// authOptions has already rejected undecodable or expired JWTs
+	claims, _ := UserClaims(s)
+
+	tlsOpts, err := tlsOptions(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = append(opts, tlsOpts...)
+
+	if prefix := s.Options["inbox_prefix"].Value; prefix != "" {
+		opts = append(opts, nats.CustomInboxPrefix(prefix))
+	}
+
+	nc, err := nats.Connect(s.URL.Value, opts...)
+	if err != nil && s.AuthType.Source == SourceHelper && IsAuthRejection(err) {
+		// Ask the helper again next time rather than replaying stale credentials
+		clearCredentialHelperCache(s.Options["credential_helper"].Value)
+	}
+	return nc, claims, err
+}
+
+// tlsOptions returns the TLS connection options for the resolved settings
+func tlsOptions(s Settings) ([]nats.Option, error) {
+	var opts []nats.Option
+
+	cfg, err := TLSConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	if cfg != nil {
+		opts = append(opts, nats.Secure(cfg))
+	}
+	if s.Options["tls_first"].Value == "true" {
+		opts = append(opts, nats.TLSHandshakeFirst())
+	}
+
+	return opts, nil
+}
+
+// authOptions turns resolved credentials into NATS connection options
+func authOptions(s Settings) ([]nats.Option, error) {
+	var opts []nats.Option
+
+	source := s.AuthType.Source + " " + s.AuthType.Value
+
+	// Sealed baked secrets are only decrypted here, right before connecting
+	if s.AuthType.Source == SourceBaked && s.baked.Sealed != "" {
+		var err error
+		if s, err = unsealBaked(s); err != nil {
+			return nil, CredentialError(source, err)
+		}
+	}
+	value := func(field string) string { return s.Auth[field].Value }
+
+	switch s.AuthType.Value {
+	case "creds":
+		if err := checkCredsFile(value("creds")); err != nil {
+			return nil, CredentialError(source, err)
+		}
+		if _, err := UserClaims(s); err != nil {
+			return nil, CredentialError(source, err)
+		}
+		opts = append(opts, nats.UserCredentials(value("creds")))
+	case "userpass":
+		if value("username") == "" || value("password") == "" {
+			return nil, CredentialError(source, errors.New("both username and password must be set"))
+		}
+		opts = append(opts, nats.UserInfo(value("username"), value("password")))
+	case "token":
+		if value("token") == "" {
+			return nil, CredentialError(source, errors.New("token is empty"))
+		}
+		opts = append(opts, nats.Token(value("token")))
+	case "nkey":
+		opt, err := nkeyOption(value("nkey"))
+		if err != nil {
+			return nil, CredentialError(source, err)
+		}
+		opts = append(opts, opt)
+	case "decentralized":
+		opt, err := jwtOption(value("jwt"), value("seed"))
+		if err != nil {
+			return nil, CredentialError(source, err)
+		}
+		if _, err := UserClaims(s); err != nil {
+			return nil, CredentialError(source, err)
+		}
+		opts = append(opts, opt)
+	case "none":
+		// No authentication
+	default:
+		return nil, CredentialError(source, fmt.Errorf("unknown auth type '%s'", s.AuthType.Value))
+	}
+
+	// Silence the default async error printer; permissions violations are
+	// reported by publishMessage through nc.LastError instead
+	opts = append(opts, nats.ErrorHandler(func(*nats.Conn, *nats.Subscription, error) {}))
+
+	return opts, nil
+}
+
+// CredentialError wraps a credential construction failure with its source
+func CredentialError(source string, err error) error {
+	return fmt.Errorf("%w from %s: %v", ErrInvalidCredentials, source, err)
+}
+
+// checkCredsFile verifies a NATS credentials file contains a user JWT and seed
+func checkCredsFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := nkeys.ParseDecoratedJWT(contents); err != nil {
+		return fmt.Errorf("no user JWT in %s: %w", path, err)
+	}
+	kp, err := nkeys.ParseDecoratedUserNKey(contents)
+	if err != nil {
+		return fmt.Errorf("no user seed in %s: %w", path, err)
+	}
+	kp.Wipe()
+	return nil
+}
+
+// ReadCredsFile extracts the user JWT and seed from a NATS creds file
+func ReadCredsFile(path string) (string, string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	jwt, err := nkeys.ParseDecoratedJWT(contents)
+	if err != nil {
+		return "", "", fmt.Errorf("no user JWT in %s: %w", path, err)
+	}
+	kp, err := nkeys.ParseDecoratedUserNKey(contents)
+	if err != nil {
+		return "", "", fmt.Errorf("no user seed in %s: %w", path, err)
+	}
+	defer kp.Wipe()
+
+	seed, err := kp.Seed()
+	if err != nil {
+		return "", "", err
+	}
+	return jwt, string(seed), nil
+}
+
+// nkeyOption builds an NKey auth option from a seed file path or a raw seed
+func nkeyOption(seed string) (nats.Option, error) {
+	if seed == "" {
+		return nil, errors.New("nkey seed is empty")
+	}
+	if _, err := os.Stat(seed); err == nil {
+		return nats.NkeyOptionFromSeed(seed)
+	}
+
+	kp, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return nil, fmt.Errorf("invalid nkey seed: %w", err)
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("invalid nkey seed: %w", err)
+	}
+	return nats.Nkey(pub, kp.Sign), nil
+}
+
+// jwtOption builds a decentralized auth option after checking the seed parses
+func jwtOption(jwt, seed string) (nats.Option, error) {
+	if jwt == "" || seed == "" {
+		return nil, errors.New("both JWT and seed must be set")
+	}
+	kp, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return nil, fmt.Errorf("invalid user seed: %w", err)
+	}
+	kp.Wipe()
+	return nats.UserJWTAndSeed(jwt, seed), nil
+}
+
+// IsAuthRejection reports whether the server rejected our credentials or permissions
+func IsAuthRejection(err error) bool {
+	if errors.Is(err, nats.ErrAuthorization) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, reason := range []string{
+		nats.AUTHORIZATION_ERR,
+		nats.AUTHENTICATION_EXPIRED_ERR,
+		nats.AUTHENTICATION_REVOKED_ERR,
+		nats.ACCOUNT_AUTHENTICATION_EXPIRED_ERR,
+		nats.PERMISSIONS_ERR,
+	} {
+		if strings.Contains(msg, reason) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package clog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+)
+
+func TestNkeyOption(t *testing.T) {
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("nkeys.CreateUser() error = %v", err)
+	}
+	seed, err := user.Seed()
+	if err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+
+	if _, err := nkeyOption(string(seed)); err != nil {
+		t.Errorf("nkeyOption() with valid seed error = %v", err)
+	}
+	if _, err := nkeyOption("SUAKTEST"); err == nil {
+		t.Error("nkeyOption() with invalid seed should fail")
+	}
+	if _, err := nkeyOption(""); err == nil {
+		t.Error("nkeyOption() with empty seed should fail")
+	}
+}
+
+func TestReadCredsFile(t *testing.T) {
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("nkeys.CreateUser() error = %v", err)
+	}
+	seed, _ := user.Seed()
+
+	creds := "-----BEGIN NATS USER JWT-----\n" +
+		"eyJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5In0.e30.sig\n" +
+		"------END NATS USER JWT------\n\n" +
+		"-----BEGIN USER NKEY SEED-----\n" +
+		string(seed) + "\n" +
+		"------END USER NKEY SEED------\n"
+	path := filepath.Join(t.TempDir(), "user.creds")
+	if err := os.WriteFile(path, []byte(creds), 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	jwt, gotSeed, err := ReadCredsFile(path)
+	if err != nil {
+		t.Fatalf("ReadCredsFile() error = %v", err)
+	}
+	if jwt != "eyJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5In0.e30.sig" {
+		t.Errorf("jwt = %q", jwt)
+	}
+	if gotSeed != string(seed) {
+		t.Errorf("seed = %q, want %q", gotSeed, seed)
+	}
+}
@@ -0,0 +1,195 @@
+package clog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// natsContext is the subset of a NATS CLI context file clog understands
+// (see 'nats context save')
+type natsContext struct {
+	URL         string `json:"url"`
+	Token       string `json:"token"`
+	User        string `json:"user"`
+	Password    string `json:"password"`
+	Creds       string `json:"creds"`
+	NKey        string `json:"nkey"`
+	UserJWT     string `json:"user_jwt"`
+	Cert        string `json:"cert"`
+	Key         string `json:"key"`
+	CA          string `json:"ca"`
+	TLSFirst    bool   `json:"tls_first"`
+	InboxPrefix string `json:"inbox_prefix"`
+	NSC         string `json:"nsc"`
+}
+
+// nscProfile is the output of 'nsc generate profile'
+type nscProfile struct {
+	UserCreds string `json:"user_creds"`
+	Operator  struct {
+		Service []string `json:"service"`
+	} `json:"operator"`
+}
+
+// natsConfigDir returns the NATS CLI configuration directory
+func natsConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "nats"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "nats"), nil
+}
+
+// selectedContext returns the context chosen with 'nats context select', if any
+func selectedContext() string {
+	dir, err := natsConfigDir()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "context.txt"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// contextPath returns the file holding a named NATS CLI context
+func contextPath(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("%w: invalid context name '%s'", ErrInvalidConfig, name)
+	}
+	dir, err := natsConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return filepath.Join(dir, "context", name+".json"), nil
+}
+
+// loadContext reads a named NATS CLI context
+func loadContext(name string) (natsContext, string, error) {
+	var ctx natsContext
+
+	path, err := contextPath(name)
+	if err != nil {
+		return ctx, "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ctx, path, fmt.Errorf("%w: NATS context '%s' not found at %s", ErrInvalidConfig, name, path)
+	}
+	if err != nil {
+		return ctx, path, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	if err := json.Unmarshal(data, &ctx); err != nil {
+		return ctx, path, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+
+	if ctx.NSC != "" && ctx.Creds == "" {
+		if err := ctx.resolveNSC(); err != nil {
+			return ctx, path, err
+		}
+	}
+	return ctx, path, nil
+}
+
+// resolveNSC fills in the creds file (and URL, if unset) for a context saved
+// with --nsc, the same way the NATS CLI does
+func (c *natsContext) resolveNSC() error {
+	out, err := exec.Command("nsc", "generate", "profile", c.NSC).Output()
+	if err != nil {
+		return fmt.Errorf("%w: nsc lookup of %s failed: %v", ErrInvalidCredentials, c.NSC, err)
+	}
+
+	var profile nscProfile
+	if err := json.Unmarshal(out, &profile); err != nil {
+		return fmt.Errorf("%w: nsc lookup of %s: %v", ErrInvalidCredentials, c.NSC, err)
+	}
+
+	c.Creds = profile.UserCreds
+	if c.URL == "" {
+		c.URL = strings.Join(profile.Operator.Service, ",")
+	}
+	return nil
+}
+
+// values returns the context settings keyed by field name
+func (c natsContext) values() map[string]string {
+	values := map[string]string{
+		"url":          c.URL,
+		"creds":        c.Creds,
+		"username":     c.User,
+		"password":     c.Password,
+		"token":        c.Token,
+		"nkey":         c.NKey,
+		"ca":           c.CA,
+		"cert":         c.Cert,
+		"key":          c.Key,
+		"inbox_prefix": c.InboxPrefix,
+	}
+	if c.TLSFirst {
+		values["tls_first"] = "true"
+	}
+
+	// With a user JWT the context nkey is the user seed (or a file holding it)
+	if c.UserJWT != "" {
+		values["jwt"] = c.UserJWT
+		values["seed"] = readSeed(c.NKey)
+		values["nkey"] = ""
+	}
+	return values
+}
+
+// readSeed returns the contents of a seed file, or the value itself if it is
+// not a readable file
+func readSeed(seed string) string {
+	data, err := os.ReadFile(seed)
+	if err != nil {
+		return seed
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// TLSConfig builds the TLS configuration for the resolved CA and client
+// certificate, or nil when none are configured
+func TLSConfig(s Settings) (*tls.Config, error) {
+	ca, cert, key := s.Options["ca"].Value, s.Options["cert"].Value, s.Options["key"].Value
+	if ca == "" && cert == "" && key == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("%w: CA file: %v", ErrInvalidConfig, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates found in CA file %s", ErrInvalidConfig, ca)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if cert != "" || key != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: client certificate: %v", ErrInvalidConfig, err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	return cfg, nil
+}
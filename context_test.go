@@ -0,0 +1,198 @@
+package clog
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeContext saves a NATS CLI context under the isolated XDG_CONFIG_HOME
+func writeContext(t *testing.T, name string, ctx natsContext) {
+	t.Helper()
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "nats", "context")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("os.MkdirAll() error = %v", err)
+	}
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+}
+
+// selectContext records a context as selected, like 'nats context select'
+func selectContext(t *testing.T, name string) {
+	t.Helper()
+	path := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "nats", "context.txt")
+	if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+}
+
+func TestResolveSettingsContext(t *testing.T) {
+	tests := []struct {
+		name           string
+		flag           string
+		env            map[string]string
+		selected       string
+		wantContext    string
+		wantSource     string
+		wantURL        string
+		wantAuthSource string
+	}{
+		{
+			name:           "context from flag",
+			flag:           "claude",
+			wantContext:    "claude",
+			wantSource:     SourceFlag,
+			wantURL:        "nats://claude:4222",
+			wantAuthSource: SourceContext,
+		},
+		{
+			name:           "context from env",
+			env:            map[string]string{"NATS_CONTEXT": "claude"},
+			wantContext:    "claude",
+			wantSource:     SourceEnv,
+			wantURL:        "nats://claude:4222",
+			wantAuthSource: SourceContext,
+		},
+		{
+			name:           "selected context",
+			selected:       "claude",
+			wantContext:    "claude",
+			wantSource:     SourceSelected,
+			wantURL:        "nats://claude:4222",
+			wantAuthSource: SourceContext,
+		},
+		{
+			name:           "flag beats selected context",
+			flag:           "other",
+			selected:       "claude",
+			wantContext:    "other",
+			wantSource:     SourceFlag,
+			wantURL:        "nats://other:4222",
+			wantAuthSource: SourceContext,
+		},
+		{
+			name:           "env credentials beat context",
+			flag:           "claude",
+			env:            map[string]string{"NATS_TOKEN": "env-token"},
+			wantContext:    "claude",
+			wantSource:     SourceFlag,
+			wantURL:        "nats://claude:4222",
+			wantAuthSource: SourceEnv,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateSettings(t)
+			writeContext(t, "claude", natsContext{URL: "nats://claude:4222", Creds: "/tmp/claude.creds", InboxPrefix: "_INBOX_claude"})
+			writeContext(t, "other", natsContext{URL: "nats://other:4222", Token: "other-token"})
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if tt.selected != "" {
+				selectContext(t, tt.selected)
+			}
+
+			s, err := ResolveSettings(tt.flag, Baked{})
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+			if s.Context.Value != tt.wantContext || s.Context.Source != tt.wantSource {
+				t.Errorf("Context = %s/%s, want %s/%s", s.Context.Value, s.Context.Source, tt.wantContext, tt.wantSource)
+			}
+			if s.URL.Value != tt.wantURL {
+				t.Errorf("URL = %q, want %q", s.URL.Value, tt.wantURL)
+			}
+			if s.AuthType.Source != tt.wantAuthSource {
+				t.Errorf("AuthType source = %q, want %q", s.AuthType.Source, tt.wantAuthSource)
+			}
+		})
+	}
+}
+
+func TestResolveSettingsContextErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		context string
+	}{
+		{name: "missing context", context: "nope"},
+		{name: "path traversal", context: "../secrets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateSettings(t)
+
+			_, err := ResolveSettings(tt.context, Baked{})
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("ResolveSettings() error = %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestNATSContextValues(t *testing.T) {
+	seedFile := filepath.Join(t.TempDir(), "user.nk")
+	if err := os.WriteFile(seedFile, []byte("SUSEED\n"), 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	values := natsContext{UserJWT: "eyJ.jwt", NKey: seedFile, TLSFirst: true, CA: "/ca.pem"}.values()
+	if values["jwt"] != "eyJ.jwt" || values["seed"] != "SUSEED" || values["nkey"] != "" {
+		t.Errorf("user_jwt context values = jwt %q seed %q nkey %q", values["jwt"], values["seed"], values["nkey"])
+	}
+	if pickAuth(values) != "decentralized" {
+		t.Errorf("pickAuth() = %q, want decentralized", pickAuth(values))
+	}
+	if values["tls_first"] != "true" || values["ca"] != "/ca.pem" {
+		t.Errorf("tls values = tls_first %q ca %q", values["tls_first"], values["ca"])
+	}
+
+	values = natsContext{NKey: seedFile}.values()
+	if pickAuth(values) != "nkey" || values["nkey"] != seedFile {
+		t.Errorf("nkey context values = %q (%s)", values["nkey"], pickAuth(values))
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	if cfg, err := TLSConfig(Settings{}); cfg != nil || err != nil {
+		t.Errorf("tlsConfig() without options = %v, %v, want nil, nil", cfg, err)
+	}
+
+	s := Settings{Options: map[string]Setting{"ca": newSetting("ca", "/nonexistent/ca.pem", SourceContext)}}
+	if _, err := TLSConfig(s); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("tlsConfig() with missing CA error = %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestLoadContextNSC(t *testing.T) {
+	isolateSettings(t)
+
+	// Stand-in for 'nsc generate profile'
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho '{\"user_creds\":\"/keys/claude.creds\",\"operator\":{\"service\":[\"nats://a:4222\",\"nats://b:4222\"]}}'\n"
+	if err := os.WriteFile(filepath.Join(bin, "nsc"), []byte(script), 0o755); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+	t.Setenv("PATH", bin)
+
+	writeContext(t, "claude", natsContext{NSC: "nsc://op/claude/claude"})
+
+	ctx, _, err := loadContext("claude")
+	if err != nil {
+		t.Fatalf("loadContext() error = %v", err)
+	}
+	if ctx.Creds != "/keys/claude.creds" {
+		t.Errorf("Creds = %q, want /keys/claude.creds", ctx.Creds)
+	}
+	if ctx.URL != "nats://a:4222,nats://b:4222" {
+		t.Errorf("URL = %q, want the operator service URLs", ctx.URL)
+	}
+}
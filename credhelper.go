@@ -0,0 +1,213 @@
+package clog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Credential helpers must answer within this time
+var credentialHelperTimeout = 10 * time.Second
+
+// Helper output is cached for this long unless credential_helper_ttl or the
+// helper's expires_at says otherwise
+const defaultCredentialHelperTTL = 5 * time.Minute
+
+// helperOutput is the JSON a credential helper prints on stdout. Every field
+// is optional; credentials follow the same rules as the other sources.
+type helperOutput struct {
+	URL       string    `json:"url"`
+	Creds     string    `json:"creds"`
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	Token     string    `json:"token"`
+	NKey      string    `json:"nkey"`
+	JWT       string    `json:"jwt"`
+	Seed      string    `json:"seed"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// helperCache is a cached helper response. The values are sealed with the
+// machine key, as baked secrets are, so the cache holds no plaintext
+// passwords or seeds.
+type helperCache struct {
+	Sealed  string    `json:"sealed"`
+	Expires time.Time `json:"expires"`
+}
+
+// values returns the helper settings keyed by field name
+func (h helperOutput) values() map[string]string {
+	return map[string]string{
+		"url":      h.URL,
+		"creds":    h.Creds,
+		"username": h.Username,
+		"password": h.Password,
+		"token":    h.Token,
+		"nkey":     h.NKey,
+		"jwt":      h.JWT,
+		"seed":     h.Seed,
+	}
+}
+
+// withCredentialHelper runs the first configured credential helper and puts
+// its output just ahead of the layer that configured it
+func withCredentialHelper(layers []settingsLayer) ([]settingsLayer, error) {
+	for i, layer := range layers {
+		helper := layer.values["credential_helper"]
+		if helper == "" {
+			continue
+		}
+
+		ttl := defaultCredentialHelperTTL
+		if value := layer.values["credential_helper_ttl"]; value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("%w: credential_helper_ttl '%s' is not a duration", ErrInvalidConfig, value)
+			}
+			ttl = parsed
+		}
+
+		values, err := credentialHelperValues(helper, ttl)
+		if err != nil {
+			return nil, err
+		}
+
+		out := append([]settingsLayer{}, layers[:i]...)
+		out = append(out, settingsLayer{SourceHelper, values})
+		return append(out, layers[i:]...), nil
+	}
+	return layers, nil
+}
+
+// credentialHelperValues returns the helper's settings, from the cache when
+// a fresh entry exists
+func credentialHelperValues(helper string, ttl time.Duration) (map[string]string, error) {
+	cachePath := credentialHelperCachePath(helper)
+	if ttl > 0 && cachePath != "" {
+		if values, ok := readHelperCache(cachePath); ok {
+			return values, nil
+		}
+	}
+
+	out, err := runCredentialHelper(helper)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 && cachePath != "" {
+		expires := time.Now().Add(ttl)
+		if !out.ExpiresAt.IsZero() && out.ExpiresAt.Before(expires) {
+			expires = out.ExpiresAt
+		}
+		writeHelperCache(cachePath, out.values(), expires)
+	}
+	return out.values(), nil
+}
+
+// readHelperCache returns the cached values at path if they are still fresh.
+// An expired or unreadable entry is deleted rather than left on disk.
+func readHelperCache(path string) (map[string]string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var cached helperCache
+	if json.Unmarshal(data, &cached) != nil || !time.Now().Before(cached.Expires) {
+		_ = os.Remove(path)
+		return nil, false
+	}
+	material, err := ReadKeyMaterial(KeySourceMachine)
+	if err != nil {
+		return nil, false
+	}
+	values, err := unsealSecrets(cached.Sealed, material)
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, false
+	}
+	return values, true
+}
+
+// writeHelperCache seals values with the machine key and caches them until
+// expires. Caching is best effort; without a machine key or a writable cache
+// dir the helper just runs every time.
+func writeHelperCache(path string, values map[string]string, expires time.Time) {
+	material, err := ReadKeyMaterial(KeySourceMachine)
+	if err != nil {
+		return
+	}
+	sealed, err := SealSecrets(values, material)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(helperCache{Sealed: sealed, Expires: expires})
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(path), 0o700) != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if os.WriteFile(tmp, data, 0o600) == nil {
+		_ = os.Rename(tmp, path)
+	}
+}
+
+// runCredentialHelper executes the helper through the shell and parses its
+// JSON output
+func runCredentialHelper(helper string) (helperOutput, error) {
+	var out helperOutput
+
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", helper)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return out, fmt.Errorf("%w: credential helper timed out after %s", ErrInvalidCredentials, credentialHelperTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%v: %s", err, msg)
+		}
+		return out, fmt.Errorf("%w: credential helper failed: %v", ErrInvalidCredentials, err)
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return out, fmt.Errorf("%w: credential helper output is not valid JSON: %v", ErrInvalidCredentials, err)
+	}
+	if out.URL == "" && pickAuth(out.values()) == "" {
+		return out, fmt.Errorf("%w: credential helper returned no URL or credentials", ErrInvalidCredentials)
+	}
+	return out, nil
+}
+
+// credentialHelperCachePath returns the cache file for a helper command
+func credentialHelperCachePath(helper string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(helper))
+	return filepath.Join(dir, "clog", "helper-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// clearCredentialHelperCache drops cached helper output, e.g. after the
+// server rejects the credentials it returned
+func clearCredentialHelperCache(helper string) {
+	if path := credentialHelperCachePath(helper); path != "" {
+		_ = os.Remove(path)
+	}
+}
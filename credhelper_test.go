@@ -0,0 +1,142 @@
+package clog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeHelper writes an executable credential helper script for a test
+func writeHelper(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "helper.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o700); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+	return path
+}
+
+// writeKeyFile creates a sealing key file for a test
+func writeKeyFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "clog.key")
+	if _, err := EnsureKeyFile(path); err != nil {
+		t.Fatalf("EnsureKeyFile() error = %v", err)
+	}
+	return path
+}
+
+func TestResolveSettingsCredentialHelper(t *testing.T) {
+	cfgPath := isolateSettings(t)
+	t.Setenv("CLOG_KEY_FILE", writeKeyFile(t))
+	counter := filepath.Join(t.TempDir(), "calls")
+	helper := writeHelper(t, `echo x >> `+counter+`
+echo '{"url":"nats://helper.example.com:4222","jwt":"eyJhbGciOiJlZDI1NTE5In0.e30.sig","seed":"SUAHELPERSEED"}'
+`)
+	writeConfig(t, cfgPath, configFile{URL: "nats://config.example.com:4222", Token: "config-token", CredentialHelper: helper})
+
+	for i := 0; i < 2; i++ {
+		s, err := ResolveSettings("", Baked{})
+		if err != nil {
+			t.Fatalf("ResolveSettings() error = %v", err)
+		}
+		if s.URL.Value != "nats://helper.example.com:4222" || s.URL.Source != SourceHelper {
+			t.Errorf("url = %v", s.URL)
+		}
+		if s.AuthType.Value != "decentralized" || s.Auth["seed"].Value != "SUAHELPERSEED" {
+			t.Errorf("auth = %v %v", s.AuthType, s.Auth)
+		}
+	}
+
+	calls, _ := os.ReadFile(counter)
+	if n := strings.Count(string(calls), "x"); n != 1 {
+		t.Errorf("helper ran %d times, want 1 (second call cached)", n)
+	}
+	cache, err := os.ReadFile(credentialHelperCachePath(helper))
+	if err != nil {
+		t.Fatalf("reading cache: %v", err)
+	}
+	if strings.Contains(string(cache), "SUAHELPERSEED") {
+		t.Errorf("cache holds the plaintext seed: %s", cache)
+	}
+
+	// Environment credentials still outrank a helper configured in the file
+	t.Setenv("NATS_TOKEN", "env-token")
+	s, err := ResolveSettings("", Baked{})
+	if err != nil {
+		t.Fatalf("ResolveSettings() error = %v", err)
+	}
+	if s.AuthType.Value != "token" || s.Auth["token"].Source != SourceEnv {
+		t.Errorf("auth = %v %v, want env token", s.AuthType, s.Auth)
+	}
+
+	clearCredentialHelperCache(helper)
+	if _, err := os.Stat(credentialHelperCachePath(helper)); !os.IsNotExist(err) {
+		t.Errorf("cache file still present after clear: %v", err)
+	}
+}
+
+func TestCredentialHelperCacheExpiry(t *testing.T) {
+	isolateSettings(t)
+	t.Setenv("CLOG_KEY_FILE", writeKeyFile(t))
+	helper := writeHelper(t, `echo '{"password":"hunter2","username":"clog"}'`)
+	path := credentialHelperCachePath(helper)
+
+	writeHelperCache(path, map[string]string{"password": "hunter2"}, time.Now().Add(-time.Second))
+	if _, ok := readHelperCache(path); ok {
+		t.Error("readHelperCache() returned an expired entry")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expired cache file still present: %v", err)
+	}
+
+	// Without the key the entry cannot be read, and nothing is cached
+	writeHelperCache(path, map[string]string{"password": "hunter2"}, time.Now().Add(time.Minute))
+	t.Setenv("CLOG_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, ok := readHelperCache(path); ok {
+		t.Error("readHelperCache() unsealed without the key")
+	}
+	os.Remove(path)
+	if _, err := credentialHelperValues(helper, time.Minute); err != nil {
+		t.Fatalf("credentialHelperValues() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("cache written without a key: %v", err)
+	}
+}
+
+func TestCredentialHelperErrors(t *testing.T) {
+	isolateSettings(t)
+	origTimeout := credentialHelperTimeout
+	credentialHelperTimeout = 200 * time.Millisecond
+	defer func() { credentialHelperTimeout = origTimeout }()
+
+	tests := []struct {
+		name    string
+		script  string
+		ttl     string
+		wantErr error
+		want    string
+	}{
+		{name: "exit status", script: "echo 'vault sealed' >&2; exit 1", wantErr: ErrInvalidCredentials, want: "vault sealed"},
+		{name: "bad json", script: "echo nope", wantErr: ErrInvalidCredentials, want: "not valid JSON"},
+		{name: "empty", script: "echo '{}'", wantErr: ErrInvalidCredentials, want: "no URL or credentials"},
+		{name: "timeout", script: "sleep 5", wantErr: ErrInvalidCredentials, want: "timed out"},
+		{name: "bad ttl", script: "echo '{}'", ttl: "soon", wantErr: ErrInvalidConfig, want: "credential_helper_ttl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CLOG_CREDENTIAL_HELPER", writeHelper(t, tt.script))
+			t.Setenv("CLOG_CREDENTIAL_HELPER_TTL", tt.ttl)
+
+			_, err := ResolveSettings("", Baked{})
+			if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ResolveSettings() error = %v, want %v containing %q", err, tt.wantErr, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package clog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Repeats of an event within this window are suppressed unless dedupe_window
+// says otherwise. JetStream streams dedupe on Nats-Msg-Id separately, over
+// their own duplicate window.
+const defaultDedupeWindow = 10 * time.Second
+
+// What the local dedupe cache treats as a repeat
+const (
+	// DedupeID drops an event whose ID (e.g. from -idempotency-key) was
+	// already published (the default)
+	DedupeID = "id"
+	// DedupeContent also drops an event without an ID that is identical to
+	// one already published. Task and question events are never dropped
+	// this way, since repeating them is usually deliberate.
+	DedupeContent = "content"
+	// DedupeOff turns the local cache off
+	DedupeOff = "off"
+)
+
+// DedupeOptions returns the local dedupe cache configured by dedupe_window,
+// and what it treats as a repeat (dedupe), or nil when either is off
+func DedupeOptions(s Settings) (*DedupeCache, string, error) {
+	mode := s.Options["dedupe"].Value
+	switch mode {
+	case "":
+		mode = DedupeID
+	case DedupeID, DedupeContent, DedupeOff:
+	default:
+		return nil, "", fmt.Errorf("%w: invalid dedupe '%s'. Must be: id|content|off", ErrInvalidConfig, mode)
+	}
+
+	window := defaultDedupeWindow
+	if value := s.Options["dedupe_window"].Value; value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return nil, "", fmt.Errorf("%w: dedupe_window '%s' is not a duration", ErrInvalidConfig, value)
+		}
+		window = parsed
+	}
+	if window == 0 || mode == DedupeOff {
+		return nil, DedupeOff, nil
+	}
+	return NewDedupeCache("", window), mode, nil
+}
+
+// dedupeEntry remembers one published event
+type dedupeEntry struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// DedupeCache remembers recently published events in a small file, shared by
+// every clog process on the machine
+type DedupeCache struct {
+	path   string
+	window time.Duration
+}
+
+// NewDedupeCache remembers events for window in path, or in the user cache
+// directory when path is ""
+func NewDedupeCache(path string, window time.Duration) *DedupeCache {
+	return &DedupeCache{path: path, window: window}
+}
+
+// Seen returns the ID and time an event with this key was published, if that
+// was within the window
+func (c *DedupeCache) Seen(ctx context.Context, key string) (string, time.Time, bool, error) {
+	var entry dedupeEntry
+	err := c.update(ctx, func(entries map[string]dedupeEntry) bool {
+		entry = entries[key]
+		return false
+	})
+	if err != nil || entry.ID == "" {
+		return "", time.Time{}, false, err
+	}
+	return entry.ID, entry.Time, true, nil
+}
+
+// Record remembers that the event with this key was published with id
+func (c *DedupeCache) Record(ctx context.Context, key, id string) error {
+	return c.update(ctx, func(entries map[string]dedupeEntry) bool {
+		entries[key] = dedupeEntry{ID: id, Time: time.Now()}
+		return true
+	})
+}
+
+// update loads the unexpired entries under the lock and, if fn reports a
+// change (or expired entries were dropped), writes them back
+func (c *DedupeCache) update(ctx context.Context, fn func(map[string]dedupeEntry) bool) error {
+	path := c.path
+	if path == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("no cache directory for dedupe: %w", err)
+		}
+		path = filepath.Join(cache, "clog", "dedupe.json")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(ctx, path+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries := map[string]dedupeEntry{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// A corrupt cache only forgets recent events; start afresh
+	if len(data) > 0 && json.Unmarshal(data, &entries) != nil {
+		entries = map[string]dedupeEntry{}
+	}
+
+	changed := false
+	for key, entry := range entries {
+		if time.Since(entry.Time) > c.window {
+			delete(entries, key)
+			changed = true
+		}
+	}
+	if fn(entries) {
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	data, err = json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// DedupePublisher drops repeats of recently published events, such as an
+// agent retrying a clog call that timed out. An event with an ID (e.g. from
+// -idempotency-key) is a repeat if that ID was published; with DedupeContent,
+// one without is a repeat if an identical event was.
+type DedupePublisher struct {
+	next  Publisher
+	cache *DedupeCache
+	mode  string
+
+	// OnDuplicate, if set, is called with the ID and time of the earlier
+	// publish when an event is dropped
+	OnDuplicate func(id string, at time.Time)
+
+	// OnError, if set, is called when the cache cannot be read or written.
+	// The event is published regardless.
+	OnError func(err error)
+}
+
+// NewDedupePublisher publishes through next, dropping repeats (by DedupeID
+// or DedupeContent) remembered in cache
+func NewDedupePublisher(next Publisher, cache *DedupeCache, mode string) *DedupePublisher {
+	return &DedupePublisher{next: next, cache: cache, mode: mode}
+}
+
+// Publish publishes the event unless it repeats one published within the
+// window. Every event is given an ID here if it has none.
+func (p *DedupePublisher) Publish(ctx context.Context, e Event) error {
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if e.ID == "" && (p.mode != DedupeContent || e.Type == "task" || e.Type == "question") {
+		e.ID = newEventID()
+		return p.next.Publish(ctx, e)
+	}
+	key := dedupeKey(e)
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+
+	id, at, seen, err := p.cache.Seen(ctx, key)
+	if err != nil && p.OnError != nil {
+		p.OnError(err)
+	}
+	if seen {
+		if p.OnDuplicate != nil {
+			p.OnDuplicate(id, at)
+		}
+		return nil
+	}
+
+	if err := p.next.Publish(ctx, e); err != nil {
+		// Not remembered, so a retry can still succeed
+		return err
+	}
+	if err := p.cache.Record(ctx, key, e.ID); err != nil && p.OnError != nil {
+		p.OnError(err)
+	}
+	return nil
+}
+
+// dedupeKey identifies an event by its ID if it has one, otherwise by its
+// contents
+func dedupeKey(e Event) string {
+	if e.ID != "" {
+		return "id:" + e.ID
+	}
+	data, _ := json.Marshal([]any{e.Type, e.State, e.Message, e.UserPrompt, e.TaskNum, e.SessionID, e.AttachPaths})
+	sum := sha256.Sum256(data)
+	return "sum:" + hex.EncodeToString(sum[:16])
+}
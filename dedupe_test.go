@@ -0,0 +1,183 @@
+package clog
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestDedupeOptions(t *testing.T) {
+	tests := []struct {
+		mode     string
+		window   string
+		want     time.Duration
+		wantMode string
+		wantErr  bool
+	}{
+		{window: "", want: defaultDedupeWindow, wantMode: DedupeID},
+		{mode: "content", window: "30s", want: 30 * time.Second, wantMode: DedupeContent},
+		{window: "0", wantMode: DedupeOff},
+		{mode: "off", wantMode: DedupeOff},
+		{mode: "always", wantErr: true},
+		{window: "soon", wantErr: true},
+		{window: "-1s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.window, func(t *testing.T) {
+			isolateSettings(t)
+			t.Setenv("CLOG_DEDUPE", tt.mode)
+			t.Setenv("CLOG_DEDUPE_WINDOW", tt.window)
+			s, err := ResolveSettings("", Baked{})
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+
+			cache, mode, err := DedupeOptions(s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("DedupeOptions() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DedupeOptions() error = %v", err)
+			}
+			if mode != tt.wantMode {
+				t.Errorf("DedupeOptions() mode = %q, want %q", mode, tt.wantMode)
+			}
+			if tt.want == 0 {
+				if cache != nil {
+					t.Errorf("DedupeOptions() = %+v, want nil", cache)
+				}
+				return
+			}
+			if cache == nil || cache.window != tt.want {
+				t.Errorf("DedupeOptions() = %+v, want window %v", cache, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupePublisher(t *testing.T) {
+	var published []Event
+	publishErr := errors.New("server down")
+	failing := false
+	next := publisherFunc(func(_ context.Context, e Event) error {
+		if failing {
+			return publishErr
+		}
+		published = append(published, e)
+		return nil
+	})
+	cache := NewDedupeCache(filepath.Join(t.TempDir(), "dedupe.json"), 100*time.Millisecond)
+	byID, byContent := NewDedupePublisher(next, cache, DedupeID), NewDedupePublisher(next, cache, DedupeContent)
+	var duplicates []string
+	for _, p := range []*DedupePublisher{byID, byContent} {
+		p.OnDuplicate = func(id string, _ time.Time) { duplicates = append(duplicates, id) }
+		p.OnError = func(err error) { t.Errorf("cache error: %v", err) }
+	}
+
+	event := Event{Type: "progress", Message: "50% complete", SessionID: "s1"}
+	done := Event{Type: "task", State: "completed", Message: "Task completed", SessionID: "s1"}
+	question := Event{Type: "question", State: "blocked", Message: "Proceed?", SessionID: "s1"}
+	tests := []struct {
+		name          string
+		content       bool
+		event         Event
+		failing       bool
+		sleep         time.Duration
+		wantPublished bool
+		wantErr       bool
+	}{
+		{name: "first publish", event: event, wantPublished: true},
+		{name: "repeat without an ID", event: event, wantPublished: true},
+		{name: "task completed twice", event: done, wantPublished: true},
+		{name: "task completed again", event: done, wantPublished: true},
+		{name: "question asked twice", event: question, wantPublished: true},
+		{name: "question asked again", event: question, wantPublished: true},
+		{name: "failed publish", event: Event{ID: "key-1", Type: "progress", Message: "m"}, failing: true, wantErr: true},
+		{name: "retry after failure", event: Event{ID: "key-1", Type: "progress", Message: "m"}, wantPublished: true},
+		{name: "retry with same key", event: Event{ID: "key-1", Type: "progress", Message: "changed"}, wantPublished: false},
+		{name: "retried task with same key", event: Event{ID: "key-2", Type: "task", State: "completed", Message: "m"}, wantPublished: true},
+		{name: "retried task with same key again", event: Event{ID: "key-2", Type: "task", State: "completed", Message: "m"}, wantPublished: false},
+
+		{name: "content: first publish", content: true, event: event, wantPublished: true},
+		{name: "content: exact repeat", content: true, event: event, wantPublished: false},
+		{name: "content: different session", content: true, event: Event{Type: "progress", Message: "50% complete", SessionID: "s2"}, wantPublished: true},
+		{name: "content: repeat after window", content: true, event: event, sleep: 150 * time.Millisecond, wantPublished: true},
+		{name: "content: task completed twice", content: true, event: done, wantPublished: true},
+		{name: "content: task completed again", content: true, event: done, wantPublished: true},
+		{name: "content: question asked again", content: true, event: question, wantPublished: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			time.Sleep(tt.sleep)
+			published, duplicates, failing = nil, nil, tt.failing
+			p := byID
+			if tt.content {
+				p = byContent
+			}
+			err := p.Publish(context.Background(), tt.event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (len(published) == 1) != tt.wantPublished || (len(duplicates) == 1) == tt.wantPublished {
+				t.Errorf("published %d, duplicates %v, want published %v", len(published), duplicates, tt.wantPublished)
+			}
+			if tt.wantPublished && published[0].ID == "" {
+				t.Error("published event has no ID")
+			}
+			if tt.event.ID != "" && tt.wantPublished && published[0].ID != tt.event.ID {
+				t.Errorf("ID = %q, want the idempotency key %q", published[0].ID, tt.event.ID)
+			}
+		})
+	}
+}
+
+func TestNATSPublisherMsgID(t *testing.T) {
+	nc := connectJetStreamServer(t)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("nc.JetStream() error = %v", err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "CLOG", Subjects: []string{"claude.>"}}); err != nil {
+		t.Fatalf("AddStream() error = %v", err)
+	}
+
+	// A core NATS publish with the same ID is stored once
+	p := NewNATSPublisher(nc, nil)
+	for _, message := range []string{"first try", "retry"} {
+		if err := p.Publish(context.Background(), Event{ID: "key-1", Type: "progress", Message: message}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	if err := p.Publish(context.Background(), Event{Type: "progress", Message: "retry"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	var info *nats.StreamInfo
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if info, err = js.StreamInfo("CLOG"); err == nil && info.State.Msgs == 2 {
+			break
+		}
+	}
+	if err != nil || info.State.Msgs != 2 {
+		t.Fatalf("stream has %+v, %v, want 2 messages", info, err)
+	}
+	msg, err := js.GetMsg("CLOG", 1)
+	if err != nil {
+		t.Fatalf("GetMsg() error = %v", err)
+	}
+	if got := msg.Header.Get(nats.MsgIdHdr); got != "key-1" {
+		t.Errorf("Nats-Msg-Id = %q, want key-1", got)
+	}
+}
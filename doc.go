@@ -0,0 +1,27 @@
+// Package clog publishes Claude Code activity events (tasks, questions,
+// progress and sessions) to NATS, the same way the clog CLI does.
+//
+// Resolve the connection settings, connect, and publish:
+//
+//	s, err := clog.ResolveSettings("", clog.Baked{URL: nats.DefaultURL, AuthType: "none"})
+//	if err != nil {
+//		return err
+//	}
+//	nc, claims, err := clog.Connect(s)
+//	if err != nil {
+//		return err
+//	}
+//	defer nc.Close()
+//
+//	publisher := clog.NewNATSPublisher(nc, claims)
+//	err = publisher.Publish(ctx, clog.Event{
+//		Type:      "task",
+//		State:     "in_progress",
+//		Message:   "Adding VAT breakdown",
+//		SessionID: "nye-api",
+//	})
+//
+// ResolveSettings applies the same precedence as the CLI: environment
+// variables, then the NATS CLI context, then the clog config file, then the
+// Baked values.
+package clog
@@ -0,0 +1,238 @@
+package clog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidEvent marks an event that cannot be published
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Longest event ID (and -idempotency-key) accepted
+const maxIDLength = 128
+
+// Valid event types
+var validTypes = map[string]bool{
+	"task":     true,
+	"question": true,
+	"progress": true,
+	"session":  true,
+}
+
+// The states each event type gives a meaning to (see Subject)
+var statesByType = map[string][]string{
+	"task":     {"pending", "in_progress", "blocked", "completed"},
+	"question": {"blocked"},
+	"progress": nil,
+	"session":  {"in_progress", "completed"},
+}
+
+// ValidStates returns the states that mean something for an event type; the
+// empty state is always allowed
+func ValidStates(eventType string) []string {
+	return append([]string(nil), statesByType[eventType]...)
+}
+
+// Event is something an agent reports: a task changing state, a question,
+// a progress update, or a session starting or ending
+type Event struct {
+	ID         string // unique message ID; defaults to a random UUID
+	Type       string // task|question|progress|session
+	State      string // pending|in_progress|blocked|completed
+	Message    string
+	UserPrompt string
+	TaskNum    string // e.g. "3/15"
+	SessionID  string
+	Timestamp  time.Time // defaults to the time of publishing
+	Seq        uint64    // per-session sequence number; 0 for none
+	Redactions int       // secrets and personal data redacted before publishing
+	Privacy    string    // privacy level applied; "" for none
+
+	// Lengths in characters of a hashed message and user prompt
+	MessageLength    int
+	UserPromptLength int
+
+	AttachPaths []string     // local files to upload with the event (-attach)
+	Attachments []Attachment // uploaded files
+	Truncated   bool         // message and prompt cut short; the full payload is attached
+}
+
+// Message represents the JSON structure sent to NATS
+type Message struct {
+	Event      string `json:"event"`
+	ID         string `json:"id,omitempty"`
+	Timestamp  string `json:"timestamp"`
+	SessionID  string `json:"session_id,omitempty"`
+	Message    string `json:"message"`
+	UserPrompt string `json:"user_prompt,omitempty"`
+	State      string `json:"state,omitempty"`
+	TaskNum    string `json:"task_num,omitempty"`
+	Seq        uint64 `json:"seq,omitempty"`
+	Redactions int    `json:"redactions,omitempty"`
+
+	Privacy          string `json:"privacy,omitempty"`
+	MessageLength    int    `json:"message_length,omitempty"`
+	UserPromptLength int    `json:"user_prompt_length,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Truncated   bool         `json:"truncated,omitempty"`
+}
+
+// Validate checks the event has a known type and a message
+func (e Event) Validate() error {
+	if e.Type == "" || e.Message == "" {
+		return errors.New("-type and -message are required")
+	}
+
+	if !validTypes[e.Type] {
+		return fmt.Errorf("invalid type '%s'. Must be: task|question|progress|session", e.Type)
+	}
+
+	// IDs travel in Nats-Msg-Id and HTTP headers
+	if len(e.ID) > maxIDLength || strings.IndexFunc(e.ID, func(r rune) bool { return r <= ' ' || r == 0x7f }) >= 0 {
+		return fmt.Errorf("invalid -idempotency-key '%s'. Must be at most %d characters without spaces or control characters", e.ID, maxIDLength)
+	}
+
+	return nil
+}
+
+// Subject returns the NATS subject the event is published to
+func (e Event) Subject() string {
+	return Subject(e.Type, e.State)
+}
+
+// Payload returns the JSON message published for the event
+func (e Event) Payload() Message {
+	timestamp := e.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	return Message{
+		Event:      e.Subject(),
+		ID:         e.ID,
+		Timestamp:  timestamp.UTC().Format(time.RFC3339Nano),
+		SessionID:  e.SessionID,
+		Message:    e.Message,
+		UserPrompt: e.UserPrompt,
+		State:      e.State,
+		TaskNum:    e.TaskNum,
+		Seq:        e.Seq,
+		Redactions: e.Redactions,
+
+		Privacy:          e.Privacy,
+		MessageLength:    e.MessageLength,
+		UserPromptLength: e.UserPromptLength,
+
+		Attachments: e.Attachments,
+		Truncated:   e.Truncated,
+	}
+}
+
+// Subject maps an event type and state to a NATS subject
+func Subject(eventType, state string) string {
+	baseSubject := fmt.Sprintf("claude.%ss", eventType)
+
+	// For tasks, append state-specific suffix
+	if eventType == "task" && state != "" {
+		switch state {
+		case "in_progress":
+			return "claude.tasks.started"
+		case "completed":
+			return "claude.tasks.completed"
+		case "blocked":
+			return "claude.tasks.blocked"
+		default:
+			return baseSubject
+		}
+	}
+
+	// For questions
+	if eventType == "question" {
+		if state == "blocked" {
+			return "claude.questions.waiting"
+		}
+		return "claude.questions.asked"
+	}
+
+	// For progress
+	if eventType == "progress" {
+		return "claude.progress.update"
+	}
+
+	// For session
+	if eventType == "session" {
+		if state == "completed" {
+			return "claude.session.completed"
+		}
+		return "claude.session.started"
+	}
+
+	return baseSubject
+}
+
+// Subjects lists every subject Subject can produce, sorted
+func Subjects() []string {
+	seen := map[string]bool{}
+	for eventType := range validTypes {
+		for _, state := range []string{"", "pending", "in_progress", "blocked", "completed"} {
+			seen[Subject(eventType, state)] = true
+		}
+	}
+
+	subjects := make([]string, 0, len(seen))
+	for subject := range seen {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// ContextReminder returns a context-specific reminder for AI agents based on
+// event type and state, or "" when none applies
+func ContextReminder(eventType, userPrompt, state string) string {
+	switch eventType {
+	case "task":
+		switch state {
+		case "in_progress":
+			if userPrompt == "" {
+				return "TIP: Add -user-prompt=\"<exact user text>\" to capture full context (VERBATIM user input)"
+			}
+			return "Remember: Log completion when done: clog -type=task -state=completed -message=\"...\" -session=\"...\""
+		case "completed":
+			return "Next: Log next task or use -type=progress for multi-step work"
+		case "blocked":
+			return "Consider: Use -type=question -state=blocked if waiting for user input"
+		}
+	case "question":
+		if state == "blocked" {
+			return "Good: Always log questions before asking user"
+		}
+	case "progress":
+		return "" // No reminder needed for progress updates
+	case "session":
+		if state == "" || state == "in_progress" {
+			return "Remember: Log tasks with -type=task as you work"
+		}
+	}
+	return ""
+}
+
+// Reminders returns the reminders to show after publishing an event: the
+// configured ones first, then any context-specific tip
+func Reminders(e Event, configured ...string) []string {
+	reminders := []string{}
+	for _, reminder := range configured {
+		if reminder != "" {
+			reminders = append(reminders, reminder)
+		}
+	}
+
+	if tip := ContextReminder(e.Type, e.UserPrompt, e.State); tip != "" {
+		reminders = append(reminders, tip)
+	}
+	return reminders
+}
@@ -0,0 +1,471 @@
+package clog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		message   string
+		id        string
+		wantErr   bool
+	}{
+		{
+			name:      "valid task type with message",
+			eventType: "task",
+			message:   "Test message",
+			wantErr:   false,
+		},
+		{
+			name:      "valid question type with message",
+			eventType: "question",
+			message:   "Test question",
+			wantErr:   false,
+		},
+		{
+			name:      "valid progress type with message",
+			eventType: "progress",
+			message:   "50% complete",
+			wantErr:   false,
+		},
+		{
+			name:      "valid session type with message",
+			eventType: "session",
+			message:   "Session started",
+			wantErr:   false,
+		},
+		{
+			name:      "missing event type",
+			eventType: "",
+			message:   "Test message",
+			wantErr:   true,
+		},
+		{
+			name:      "missing message",
+			eventType: "task",
+			message:   "",
+			wantErr:   true,
+		},
+		{
+			name:      "invalid event type",
+			eventType: "invalid",
+			message:   "Test message",
+			wantErr:   true,
+		},
+		{
+			name:      "both missing",
+			eventType: "",
+			message:   "",
+			wantErr:   true,
+		},
+		{
+			name:      "idempotency key as ID",
+			eventType: "task",
+			message:   "Test message",
+			id:        "retry-3f2a",
+			wantErr:   false,
+		},
+		{
+			name:      "ID with spaces",
+			eventType: "task",
+			message:   "Test message",
+			id:        "retry 1",
+			wantErr:   true,
+		},
+		{
+			name:      "ID too long",
+			eventType: "task",
+			message:   "Test message",
+			id:        strings.Repeat("x", 129),
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Event{Type: tt.eventType, Message: tt.message, ID: tt.id}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubject(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		state     string
+		want      string
+	}{
+		// Task mappings
+		{
+			name:      "task in_progress",
+			eventType: "task",
+			state:     "in_progress",
+			want:      "claude.tasks.started",
+		},
+		{
+			name:      "task completed",
+			eventType: "task",
+			state:     "completed",
+			want:      "claude.tasks.completed",
+		},
+		{
+			name:      "task blocked",
+			eventType: "task",
+			state:     "blocked",
+			want:      "claude.tasks.blocked",
+		},
+		{
+			name:      "task with pending state",
+			eventType: "task",
+			state:     "pending",
+			want:      "claude.tasks",
+		},
+		{
+			name:      "task without state",
+			eventType: "task",
+			state:     "",
+			want:      "claude.tasks",
+		},
+		// Question mappings
+		{
+			name:      "question blocked",
+			eventType: "question",
+			state:     "blocked",
+			want:      "claude.questions.waiting",
+		},
+		{
+			name:      "question without state",
+			eventType: "question",
+			state:     "",
+			want:      "claude.questions.asked",
+		},
+		{
+			name:      "question with any other state",
+			eventType: "question",
+			state:     "answered",
+			want:      "claude.questions.asked",
+		},
+		// Progress mappings
+		{
+			name:      "progress",
+			eventType: "progress",
+			state:     "",
+			want:      "claude.progress.update",
+		},
+		{
+			name:      "progress with state",
+			eventType: "progress",
+			state:     "50",
+			want:      "claude.progress.update",
+		},
+		// Session mappings
+		{
+			name:      "session completed",
+			eventType: "session",
+			state:     "completed",
+			want:      "claude.session.completed",
+		},
+		{
+			name:      "session started",
+			eventType: "session",
+			state:     "",
+			want:      "claude.session.started",
+		},
+		{
+			name:      "session with any other state",
+			eventType: "session",
+			state:     "active",
+			want:      "claude.session.started",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Subject(tt.eventType, tt.state)
+			if got != tt.want {
+				t.Errorf("Subject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubjects(t *testing.T) {
+	want := []string{
+		"claude.progress.update",
+		"claude.questions.asked",
+		"claude.questions.waiting",
+		"claude.session.completed",
+		"claude.session.started",
+		"claude.tasks",
+		"claude.tasks.blocked",
+		"claude.tasks.completed",
+		"claude.tasks.started",
+	}
+
+	got := Subjects()
+	if len(got) != len(want) {
+		t.Fatalf("Subjects() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Subjects()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMessageJSONMarshaling(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		wantErr bool
+	}{
+		{
+			name: "complete message",
+			msg: Message{
+				Event:     "claude.tasks.started",
+				Timestamp: "2025-10-09T14:30:00Z",
+				SessionID: "test-session",
+				Message:   "Test message",
+				State:     "in_progress",
+				TaskNum:   "3/15",
+			},
+			wantErr: false,
+		},
+		{
+			name: "message with empty optional fields",
+			msg: Message{
+				Event:     "claude.progress.update",
+				Timestamp: "2025-10-09T14:30:00Z",
+				Message:   "50% complete",
+			},
+			wantErr: false,
+		},
+		{
+			name: "message with only required fields",
+			msg: Message{
+				Event:     "claude.questions.asked",
+				Timestamp: "2025-10-09T14:30:00Z",
+				Message:   "What should I do?",
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("json.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if err == nil {
+				// Verify we can unmarshal it back
+				var unmarshaled Message
+				if err := json.Unmarshal(data, &unmarshaled); err != nil {
+					t.Errorf("json.Unmarshal() error = %v", err)
+				}
+
+				// Verify required fields match
+				if unmarshaled.Event != tt.msg.Event {
+					t.Errorf("Event mismatch: got %v, want %v", unmarshaled.Event, tt.msg.Event)
+				}
+				if unmarshaled.Message != tt.msg.Message {
+					t.Errorf("Message mismatch: got %v, want %v", unmarshaled.Message, tt.msg.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageOmitEmpty(t *testing.T) {
+	msg := Message{
+		Event:     "claude.tasks.started",
+		Timestamp: "2025-10-09T14:30:00Z",
+		Message:   "Test message",
+		// SessionID, State, and TaskNum are empty
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	// Parse the JSON to check that empty fields are omitted
+	var rawJSON map[string]any
+	if err := json.Unmarshal(data, &rawJSON); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	// Check that optional fields are not present in JSON
+	if _, exists := rawJSON["session_id"]; exists {
+		t.Error("session_id should be omitted when empty")
+	}
+	if _, exists := rawJSON["state"]; exists {
+		t.Error("state should be omitted when empty")
+	}
+	if _, exists := rawJSON["task_num"]; exists {
+		t.Error("task_num should be omitted when empty")
+	}
+
+	// Check that required fields are present
+	if _, exists := rawJSON["event"]; !exists {
+		t.Error("event should be present")
+	}
+	if _, exists := rawJSON["timestamp"]; !exists {
+		t.Error("timestamp should be present")
+	}
+	if _, exists := rawJSON["message"]; !exists {
+		t.Error("message should be present")
+	}
+}
+
+func TestContextReminder(t *testing.T) {
+	tests := []struct {
+		name       string
+		eventType  string
+		userPrompt string
+		state      string
+		want       string
+	}{
+		{
+			name:       "task in_progress with user prompt",
+			eventType:  "task",
+			userPrompt: "user input",
+			state:      "in_progress",
+			want:       "Remember: Log completion when done: clog -type=task -state=completed -message=\"...\" -session=\"...\"",
+		},
+		{
+			name:       "task in_progress without user prompt",
+			eventType:  "task",
+			userPrompt: "",
+			state:      "in_progress",
+			want:       "TIP: Add -user-prompt=\"<exact user text>\" to capture full context (VERBATIM user input)",
+		},
+		{
+			name:       "task completed",
+			eventType:  "task",
+			userPrompt: "",
+			state:      "completed",
+			want:       "Next: Log next task or use -type=progress for multi-step work",
+		},
+		{
+			name:       "task blocked",
+			eventType:  "task",
+			userPrompt: "",
+			state:      "blocked",
+			want:       "Consider: Use -type=question -state=blocked if waiting for user input",
+		},
+		{
+			name:       "question blocked",
+			eventType:  "question",
+			userPrompt: "",
+			state:      "blocked",
+			want:       "Good: Always log questions before asking user",
+		},
+		{
+			name:       "progress",
+			eventType:  "progress",
+			userPrompt: "",
+			state:      "",
+			want:       "",
+		},
+		{
+			name:       "session started",
+			eventType:  "session",
+			userPrompt: "",
+			state:      "",
+			want:       "Remember: Log tasks with -type=task as you work",
+		},
+		{
+			name:       "session in_progress",
+			eventType:  "session",
+			userPrompt: "",
+			state:      "in_progress",
+			want:       "Remember: Log tasks with -type=task as you work",
+		},
+		{
+			name:       "session completed",
+			eventType:  "session",
+			userPrompt: "",
+			state:      "completed",
+			want:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ContextReminder(tt.eventType, tt.userPrompt, tt.state)
+			if got != tt.want {
+				t.Errorf("ContextReminder() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidTypes(t *testing.T) {
+	expectedTypes := []string{"task", "question", "progress", "session"}
+
+	for _, typ := range expectedTypes {
+		if !validTypes[typ] {
+			t.Errorf("validTypes should contain '%s'", typ)
+		}
+	}
+
+	// Check that unexpected types are not valid
+	invalidTypes := []string{"invalid", "foo", "bar", ""}
+	for _, typ := range invalidTypes {
+		if validTypes[typ] {
+			t.Errorf("validTypes should not contain '%s'", typ)
+		}
+	}
+}
+
+func TestEventPayload(t *testing.T) {
+	event := Event{
+		Type:      "task",
+		State:     "in_progress",
+		Message:   "Test message",
+		SessionID: "test-session",
+		Timestamp: time.Date(2025, 10, 9, 16, 30, 0, 123456789, time.FixedZone("CEST", 2*60*60)),
+		Seq:       7,
+	}
+
+	got := event.Payload()
+	if got.Event != "claude.tasks.started" {
+		t.Errorf("Event = %q, want claude.tasks.started", got.Event)
+	}
+	if got.Timestamp != "2025-10-09T14:30:00.123456789Z" {
+		t.Errorf("Timestamp = %q, want UTC RFC3339Nano", got.Timestamp)
+	}
+	if got.SessionID != "test-session" || got.State != "in_progress" || got.Seq != 7 {
+		t.Errorf("Payload() = %+v", got)
+	}
+
+	if got := (Event{Type: "progress", Message: "m"}).Payload(); got.Timestamp == "" {
+		t.Error("Payload() without timestamp should default to now")
+	}
+}
+
+func TestReminders(t *testing.T) {
+	event := Event{Type: "task", State: "completed", Message: "done"}
+
+	got := Reminders(event, "Use clog", "", "Log questions")
+	want := []string{"Use clog", "Log questions", ContextReminder("task", "", "completed")}
+	if len(got) != len(want) {
+		t.Fatalf("Reminders() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Reminders()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package clog
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// Warn in the success reminders when the user JWT expires within this window
+const jwtExpiryWarning = 72 * time.Hour
+
+// UserClaims decodes the user JWT for creds and decentralized auth, or
+// returns nil for other auth types. An expired JWT is an error.
+func UserClaims(s Settings) (*jwt.UserClaims, error) {
+	if value := s.Auth["jwt"]; value.Sealed && value.Value == "" {
+		unsealed, err := unsealBaked(s)
+		if err != nil {
+			return nil, err
+		}
+		s = unsealed
+	}
+
+	var token string
+	switch s.AuthType.Value {
+	case "creds":
+		contents, err := os.ReadFile(s.Auth["creds"].Value)
+		if err != nil {
+			return nil, err
+		}
+		if token, err = nkeys.ParseDecoratedJWT(contents); err != nil {
+			return nil, fmt.Errorf("no user JWT in %s: %w", s.Auth["creds"].Value, err)
+		}
+	case "decentralized":
+		token = s.Auth["jwt"].Value
+	default:
+		return nil, nil
+	}
+
+	claims, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user JWT: %w", err)
+	}
+
+	if expires := ClaimsExpiry(claims); !expires.IsZero() && !time.Now().Before(expires) {
+		return claims, fmt.Errorf("user JWT for %s expired at %s (%s ago); rotate the credentials",
+			claimsName(claims), expires.UTC().Format(time.RFC3339), formatDuration(time.Since(expires)))
+	}
+	return claims, nil
+}
+
+// ClaimsExpiry returns when the JWT expires, or the zero time if it never does
+func ClaimsExpiry(claims *jwt.UserClaims) time.Time {
+	if claims == nil || claims.Expires == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Expires, 0)
+}
+
+// claimsName returns the JWT name, falling back to the user public key
+func claimsName(claims *jwt.UserClaims) string {
+	if claims.Name != "" {
+		return claims.Name
+	}
+	return claims.Subject
+}
+
+// ExpiryReminder returns a rotation warning when the JWT expires soon. Short
+// lived credentials (such as minted ones) only warn in the last quarter of
+// their lifetime.
+func ExpiryReminder(claims *jwt.UserClaims, now time.Time) string {
+	expires := ClaimsExpiry(claims)
+	if expires.IsZero() {
+		return ""
+	}
+
+	window := jwtExpiryWarning
+	if claims.IssuedAt > 0 {
+		if quarter := expires.Sub(time.Unix(claims.IssuedAt, 0)) / 4; quarter < window {
+			window = quarter
+		}
+	}
+	if expires.Sub(now) > window {
+		return ""
+	}
+	return fmt.Sprintf("WARNING: NATS credentials expire in %s (%s) - rotate them before they lapse",
+		formatDuration(expires.Sub(now)), expires.UTC().Format(time.RFC3339))
+}
+
+// DescribeClaims summarises the claims for 'clog doctor'
+func DescribeClaims(claims *jwt.UserClaims) []string {
+	lines := []string{
+		fmt.Sprintf("user %s (%s)", claimsName(claims), claims.Subject),
+		"issuer " + claims.Issuer,
+	}
+	if claims.IssuerAccount != "" {
+		lines = append(lines, "account "+claims.IssuerAccount)
+	}
+
+	pub := "allow all"
+	if len(claims.Pub.Allow) > 0 {
+		pub = "allow " + strings.Join(claims.Pub.Allow, ", ")
+	}
+	if len(claims.Pub.Deny) > 0 {
+		pub += "; deny " + strings.Join(claims.Pub.Deny, ", ")
+	}
+	lines = append(lines, "publish "+pub)
+	if scope := SessionScope(claims); scope != "" {
+		lines = append(lines, "scoped to session "+scope)
+	}
+
+	if expires := ClaimsExpiry(claims); expires.IsZero() {
+		lines = append(lines, "expires never")
+	} else {
+		lines = append(lines, fmt.Sprintf("expires %s (in %s)", expires.UTC().Format(time.RFC3339), formatDuration(time.Until(expires))))
+	}
+	return lines
+}
+
+// CanPublish reports whether claims let the user publish to subject: it
+// matches an allow entry, or there are none, and no deny entry. This is what
+// the user JWT says; the account can still restrict it further.
+func CanPublish(claims *jwt.UserClaims, subject string) bool {
+	allowed := len(claims.Pub.Allow) == 0
+	for _, filter := range claims.Pub.Allow {
+		allowed = allowed || subjectMatches(filter, subject)
+	}
+	for _, filter := range claims.Pub.Deny {
+		if subjectMatches(filter, subject) {
+			return false
+		}
+	}
+	return allowed
+}
+
+// subjectMatches reports whether subject matches filter, where "*" matches
+// one token and a trailing ">" one or more
+func subjectMatches(filter, subject string) bool {
+	filterTokens, subjectTokens := strings.Split(filter, "."), strings.Split(subject, ".")
+	for i, token := range filterTokens {
+		if token == ">" && i == len(filterTokens)-1 {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(filterTokens) == len(subjectTokens)
+}
+
+// formatDuration renders a duration in days, hours and minutes
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	minutes := (d - hours*time.Hour) / time.Minute
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
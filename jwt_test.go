@@ -0,0 +1,187 @@
+package clog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// newUserJWT issues a signed user JWT and returns it with the user seed
+func newUserJWT(t *testing.T, expires time.Time, allow ...string) (string, string) {
+	t.Helper()
+	account, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatalf("nkeys.CreateAccount() error = %v", err)
+	}
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("nkeys.CreateUser() error = %v", err)
+	}
+	pub, _ := user.PublicKey()
+	seed, _ := user.Seed()
+
+	claims := jwt.NewUserClaims(pub)
+	claims.Name = "claude"
+	claims.Pub.Allow.Add(allow...)
+	if !expires.IsZero() {
+		claims.Expires = expires.Unix()
+	}
+	token, err := claims.Encode(account)
+	if err != nil {
+		t.Fatalf("claims.Encode() error = %v", err)
+	}
+	return token, string(seed)
+}
+
+func TestUserClaims(t *testing.T) {
+	tests := []struct {
+		name    string
+		expires time.Time
+		wantErr string
+	}{
+		{name: "no expiry"},
+		{name: "expires next month", expires: time.Now().Add(30 * 24 * time.Hour)},
+		{name: "expires in two days", expires: time.Now().Add(50 * time.Hour)},
+		{name: "expired", expires: time.Now().Add(-2 * time.Hour), wantErr: "expired at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, seed := newUserJWT(t, tt.expires)
+			s := Settings{
+				AuthType: Setting{Value: "decentralized", Source: SourceEnv},
+				Auth: map[string]Setting{
+					"jwt":  newSetting("jwt", token, SourceEnv),
+					"seed": newSetting("seed", seed, SourceEnv),
+				},
+			}
+
+			claims, err := UserClaims(s)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("userClaims() error = %v, want %q", err, tt.wantErr)
+				}
+				if _, err := authOptions(s); err == nil {
+					t.Error("authOptions() should refuse an expired JWT")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("userClaims() error = %v", err)
+			}
+
+			if claims.Name != "claude" {
+				t.Errorf("claims.Name = %q, want claude", claims.Name)
+			}
+		})
+	}
+
+	if claims, err := UserClaims(Settings{AuthType: Setting{Value: "token"}}); claims != nil || err != nil {
+		t.Errorf("userClaims() for token auth = %v, %v, want nil, nil", claims, err)
+	}
+
+	bad := Settings{
+		AuthType: Setting{Value: "decentralized"},
+		Auth:     map[string]Setting{"jwt": {Value: "not.a.jwt"}},
+	}
+	if _, err := UserClaims(bad); err == nil {
+		t.Error("userClaims() with malformed JWT should fail")
+	}
+}
+
+func TestExpiryReminder(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		issued   time.Time
+		expires  time.Time
+		wantWarn bool
+	}{
+		{name: "never expires", issued: now.Add(-time.Hour)},
+		{name: "long lived, far off", issued: now.Add(-90 * 24 * time.Hour), expires: now.Add(10 * 24 * time.Hour)},
+		{name: "long lived, within 72h", issued: now.Add(-90 * 24 * time.Hour), expires: now.Add(48 * time.Hour), wantWarn: true},
+		{name: "minted, fresh", issued: now, expires: now.Add(24 * time.Hour)},
+		{name: "minted, last quarter", issued: now.Add(-20 * time.Hour), expires: now.Add(4 * time.Hour), wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.NewUserClaims("UTEST")
+			claims.IssuedAt = tt.issued.Unix()
+			if !tt.expires.IsZero() {
+				claims.Expires = tt.expires.Unix()
+			}
+
+			got := ExpiryReminder(claims, now)
+			if (got != "") != tt.wantWarn {
+				t.Errorf("expiryReminder() = %q, want warning %v", got, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestDescribeClaims(t *testing.T) {
+	token, _ := newUserJWT(t, time.Now().Add(48*time.Hour), "claude.>")
+	claims, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatalf("jwt.DecodeUserClaims() error = %v", err)
+	}
+
+	got := strings.Join(DescribeClaims(claims), "\n")
+	for _, want := range []string{"user claude", "issuer " + claims.Issuer, "publish allow claude.>", "expires "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("describeClaims() = %q, missing %q", got, want)
+		}
+	}
+}
+
+func TestCanPublish(t *testing.T) {
+	claims := jwt.NewUserClaims("U")
+	claims.Pub.Allow.Add("claude.>", "_clog.*")
+	claims.Pub.Deny.Add("claude.control.*")
+
+	tests := []struct {
+		subject string
+		want    bool
+	}{
+		{subject: "claude.tasks.started", want: true},
+		{subject: "claude.tasks", want: true},
+		{subject: "claude", want: false},
+		{subject: "_clog.doctor", want: true},
+		{subject: "_clog.doctor.probe", want: false},
+		{subject: "claude.control.s1", want: false},
+		{subject: "claude.control.s1.x", want: true},
+		{subject: "other.tasks", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			if got := CanPublish(claims, tt.subject); got != tt.want {
+				t.Errorf("CanPublish(%s) = %v, want %v", tt.subject, got, tt.want)
+			}
+		})
+	}
+
+	if !CanPublish(jwt.NewUserClaims("U"), "claude.tasks.started") {
+		t.Error("CanPublish() without publish permissions = false, want true")
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 30 * time.Second, want: "1m"},
+		{d: 90 * time.Minute, want: "1h30m"},
+		{d: 50 * time.Hour, want: "2d2h"},
+	}
+
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("formatDuration(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
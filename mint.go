@@ -0,0 +1,107 @@
+package clog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// sessionScopeTag marks user JWTs minted by MintCreds
+const sessionScopeTag = "clog-session"
+
+// Session IDs must be a single subject token to be used in a scope
+var sessionTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// MintCreds issues a user JWT and seed that may only publish the session's
+// scoped subjects, formatted as a .creds file. signingKey is an account seed
+// or a file holding one; account is only needed when it is a signing key
+// rather than the account's own key.
+func MintCreds(signingKey, account, session, name string, ttl time.Duration) ([]byte, *jwt.UserClaims, error) {
+	signingSeed := readSeed(signingKey)
+	if !sessionTokenPattern.MatchString(session) {
+		return nil, nil, fmt.Errorf("-session must be letters, digits, '-' or '_' (got '%s')", session)
+	}
+	if ttl <= 0 {
+		return nil, nil, errors.New("-ttl must be positive")
+	}
+	if signingSeed == "" {
+		return nil, nil, errors.New("-signing-key is required")
+	}
+
+	signer, err := nkeys.FromSeed([]byte(signingSeed))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	defer signer.Wipe()
+	signerPub, err := signer.PublicKey()
+	if err != nil || !nkeys.IsValidPublicAccountKey(signerPub) {
+		return nil, nil, errors.New("signing key must be an account seed (starting with SA)")
+	}
+	if account != "" && !nkeys.IsValidPublicAccountKey(account) {
+		return nil, nil, fmt.Errorf("invalid account public key '%s'", account)
+	}
+
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer user.Wipe()
+	userPub, err := user.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	userSeed, err := user.Seed()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims := jwt.NewUserClaims(userPub)
+	claims.Name = name
+	claims.Expires = time.Now().Add(ttl).Unix()
+	claims.Tags.Add(sessionScopeTag)
+	claims.Pub.Allow.Add(ScopedSubjects(session)...)
+	claims.Sub.Allow.Add("_INBOX.>")
+	if account != "" && account != signerPub {
+		claims.IssuerAccount = account
+	}
+
+	token, err := claims.Encode(signer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("signing user JWT: %w", err)
+	}
+
+	creds, err := jwt.FormatUserConfig(token, userSeed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return creds, claims, nil
+}
+
+// ScopedSubjects returns every subject clog publishes to, suffixed with the
+// session token
+func ScopedSubjects(session string) []string {
+	subjects := Subjects()
+	for i, subject := range subjects {
+		subjects[i] = subject + "." + session
+	}
+	return subjects
+}
+
+// SessionScope returns the session minted credentials are limited to, or ""
+// for unscoped credentials
+func SessionScope(claims *jwt.UserClaims) string {
+	if claims == nil || !claims.Tags.Contains(sessionScopeTag) || len(claims.Pub.Allow) == 0 {
+		return ""
+	}
+	for _, subject := range Subjects() {
+		if session, ok := strings.CutPrefix(claims.Pub.Allow[0], subject+"."); ok && sessionTokenPattern.MatchString(session) {
+			return session
+		}
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package clog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+func TestMintCreds(t *testing.T) {
+	account, _ := nkeys.CreateAccount()
+	accountPub, _ := account.PublicKey()
+	accountSeed, _ := account.Seed()
+	signingKey, _ := nkeys.CreateAccount()
+	signingSeed, _ := signingKey.Seed()
+	user, _ := nkeys.CreateUser()
+	userSeed, _ := user.Seed()
+
+	tests := []struct {
+		name        string
+		seed        string
+		account     string
+		session     string
+		ttl         time.Duration
+		wantErr     string
+		wantAccount string
+	}{
+		{name: "account key", seed: string(accountSeed), session: "agent-1", ttl: time.Hour},
+		{name: "signing key", seed: string(signingSeed), account: accountPub, session: "agent_2", ttl: time.Hour, wantAccount: accountPub},
+		{name: "session with dots", seed: string(accountSeed), session: "a.b", ttl: time.Hour, wantErr: "-session"},
+		{name: "empty session", seed: string(accountSeed), ttl: time.Hour, wantErr: "-session"},
+		{name: "user seed", seed: string(userSeed), session: "s", ttl: time.Hour, wantErr: "account seed"},
+		{name: "no key", session: "s", ttl: time.Hour, wantErr: "-signing-key"},
+		{name: "zero ttl", seed: string(accountSeed), session: "s", wantErr: "-ttl"},
+		{name: "bad account", seed: string(signingSeed), account: "ABAD", session: "s", ttl: time.Hour, wantErr: "account public key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds, _, err := MintCreds(tt.seed, tt.account, tt.session, "clog-"+tt.session, tt.ttl)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("MintCreds() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MintCreds() error = %v", err)
+			}
+
+			path := filepath.Join(t.TempDir(), "agent.creds")
+			if err := os.WriteFile(path, creds, 0o600); err != nil {
+				t.Fatalf("os.WriteFile() error = %v", err)
+			}
+			token, _, err := ReadCredsFile(path)
+			if err != nil {
+				t.Fatalf("ReadCredsFile() error = %v", err)
+			}
+
+			claims, err := jwt.DecodeUserClaims(token)
+			if err != nil {
+				t.Fatalf("jwt.DecodeUserClaims() error = %v", err)
+			}
+			if got := SessionScope(claims); got != tt.session {
+				t.Errorf("SessionScope() = %q, want %q", got, tt.session)
+			}
+			if claims.IssuerAccount != tt.wantAccount {
+				t.Errorf("IssuerAccount = %q, want %q", claims.IssuerAccount, tt.wantAccount)
+			}
+			if len(claims.Pub.Allow) != len(Subjects()) || !claims.Pub.Allow.Contains("claude.tasks.started."+tt.session) {
+				t.Errorf("Pub.Allow = %v", claims.Pub.Allow)
+			}
+			if remaining := time.Until(ClaimsExpiry(claims)); remaining <= 0 || remaining > tt.ttl {
+				t.Errorf("expires in %s, want within %s", remaining, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestSessionScopeUnscoped(t *testing.T) {
+	token, _ := newUserJWT(t, time.Time{}, "claude.tasks.started.agent")
+	claims, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatalf("jwt.DecodeUserClaims() error = %v", err)
+	}
+	if got := SessionScope(claims); got != "" {
+		t.Errorf("SessionScope() without tag = %q, want empty", got)
+	}
+	if got := SessionScope(nil); got != "" {
+		t.Errorf("SessionScope(nil) = %q, want empty", got)
+	}
+}
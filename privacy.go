@@ -0,0 +1,198 @@
+package clog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"unicode/utf8"
+)
+
+// Privacy levels accepted in the privacy setting, from least to most private
+const (
+	// PrivacyOff publishes messages and prompts as they are (the default)
+	PrivacyOff = "off"
+	// PrivacyOmit drops the user prompt
+	PrivacyOmit = "omit"
+	// PrivacyHash replaces the message and user prompt with salted hashes
+	// and their lengths
+	PrivacyHash = "hash"
+)
+
+var privacyLevels = []string{PrivacyOff, PrivacyOmit, PrivacyHash}
+
+// ProjectFile is the per-project settings file, looked for in the working
+// directory and its parents. Only its privacy setting is used, and only when
+// it is stricter than the configured one, so a repository can never make
+// clog publish more than its user allows.
+const ProjectFile = ".clog.json"
+
+// PrivacyOptions returns the configured privacy level and, for PrivacyHash,
+// the salt to hash with: privacy_salt if set, otherwise a random salt kept
+// in the user config directory
+func PrivacyOptions(s Settings) (string, []byte, error) {
+	level := s.Options["privacy"].Value
+	if level == "" {
+		level = PrivacyOff
+	}
+	if !slices.Contains(privacyLevels, level) {
+		return "", nil, fmt.Errorf("%w: invalid privacy '%s'. Must be: off|omit|hash", ErrInvalidConfig, level)
+	}
+	if level != PrivacyHash {
+		return level, nil, nil
+	}
+
+	if salt := s.Options["privacy_salt"].Value; salt != "" {
+		return level, []byte(salt), nil
+	}
+	salt, err := machineSalt()
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: privacy salt: %v", ErrInvalidConfig, err)
+	}
+	return level, salt, nil
+}
+
+// machineSalt returns the salt kept in the user config directory, creating
+// it on first use
+func machineSalt() ([]byte, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "clog", "privacy_salt")
+	if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+		return data, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	encoded := []byte(hex.EncodeToString(salt))
+	// Exclusive, so two first runs agree on one salt
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(encoded); err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// applyProjectPrivacy raises the privacy option to the level in the nearest
+// project file, if that is stricter
+func applyProjectPrivacy(s *Settings) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	path, level, err := findProjectPrivacy(dir)
+	if err != nil {
+		return err
+	}
+	s.ProjectPath = path
+
+	current := s.Options["privacy"].Value
+	if current == "" {
+		current = PrivacyOff
+	}
+	if level != "" && slices.Index(privacyLevels, level) > slices.Index(privacyLevels, current) {
+		s.Options["privacy"] = newSetting("privacy", level, SourceProject)
+	}
+	return nil
+}
+
+// findProjectPrivacy returns the nearest project file at or above dir, or ""
+// when there is none, and the privacy level it sets
+func findProjectPrivacy(dir string) (string, string, error) {
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var project struct {
+				Privacy string `json:"privacy"`
+			}
+			if err := json.Unmarshal(data, &project); err != nil {
+				return "", "", fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+			}
+			if project.Privacy != "" && !slices.Contains(privacyLevels, project.Privacy) {
+				return "", "", fmt.Errorf("%w: %s: invalid privacy '%s'. Must be: off|omit|hash", ErrInvalidConfig, path, project.Privacy)
+			}
+			return path, project.Privacy, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", "", fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
+
+// PrivacyPublisher applies a privacy level to events before anything else
+// sees them, marking each event with the level so consumers can tell a
+// hashed or missing prompt from an empty one
+type PrivacyPublisher struct {
+	next  Publisher
+	level string
+	salt  []byte
+}
+
+// NewPrivacyPublisher applies level (hashing with salt) before publishing
+// through next
+func NewPrivacyPublisher(next Publisher, level string, salt []byte) *PrivacyPublisher {
+	return &PrivacyPublisher{next: next, level: level, salt: salt}
+}
+
+// Publish drops or hashes the event's prompt and message, then publishes it
+func (p *PrivacyPublisher) Publish(ctx context.Context, e Event) error {
+	// A hash of an empty message would pass validation
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	// Attached files are redacted, but cannot be dropped or hashed
+	if p.level != PrivacyOff && len(e.AttachPaths) > 0 {
+		return fmt.Errorf("%w: attachments cannot be published with privacy '%s'", ErrInvalidEvent, p.level)
+	}
+	switch p.level {
+	case PrivacyOmit:
+		e.UserPrompt = ""
+	case PrivacyHash:
+		e.MessageLength = utf8.RuneCountInString(e.Message)
+		e.Message = p.hash(e.Message)
+		if e.UserPrompt != "" {
+			e.UserPromptLength = utf8.RuneCountInString(e.UserPrompt)
+			e.UserPrompt = p.hash(e.UserPrompt)
+		}
+	}
+	if p.level != PrivacyOff {
+		e.Privacy = p.level
+	}
+	return p.next.Publish(ctx, e)
+}
+
+// hash returns "sha256:" and the hex HMAC-SHA256 of text keyed with the
+// salt, so equal texts can be matched without being readable or guessable
+func (p *PrivacyPublisher) hash(text string) string {
+	mac := hmac.New(sha256.New, p.salt)
+	mac.Write([]byte(text))
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,195 @@
+package clog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chdir changes the working directory for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestPrivacyOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		privacy    string
+		project    string // contents of the project file, if any
+		want       string
+		wantSource string
+		wantErr    bool
+	}{
+		{name: "default", want: PrivacyOff},
+		{name: "omit", privacy: "omit", want: PrivacyOmit, wantSource: SourceEnv},
+		{name: "hash", privacy: "hash", want: PrivacyHash, wantSource: SourceEnv},
+		{name: "invalid", privacy: "secret", wantErr: true},
+		{name: "project raises", privacy: "omit", project: `{"privacy": "hash"}`, want: PrivacyHash, wantSource: SourceProject},
+		{name: "project cannot lower", privacy: "hash", project: `{"privacy": "off"}`, want: PrivacyHash, wantSource: SourceEnv},
+		{name: "project without privacy", project: `{}`, want: PrivacyOff},
+		{name: "invalid project level", project: `{"privacy": "secret"}`, wantErr: true},
+		{name: "invalid project file", project: `privacy: hash`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateSettings(t)
+			t.Setenv("CLOG_PRIVACY", tt.privacy)
+			root := t.TempDir()
+			work := filepath.Join(root, "src", "app")
+			os.MkdirAll(work, 0o700)
+			if tt.project != "" {
+				os.WriteFile(filepath.Join(root, ProjectFile), []byte(tt.project), 0o600)
+			}
+			chdir(t, work)
+
+			s, err := ResolveSettings("", Baked{})
+			if err == nil {
+				var level string
+				level, _, err = PrivacyOptions(s)
+				if err == nil && level != tt.want {
+					t.Errorf("PrivacyOptions() = %q, want %q", level, tt.want)
+				}
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if source := s.Options["privacy"].Source; source != tt.wantSource {
+				t.Errorf("privacy source = %q, want %q", source, tt.wantSource)
+			}
+			if tt.project != "" && s.ProjectPath != filepath.Join(root, ProjectFile) {
+				t.Errorf("ProjectPath = %q", s.ProjectPath)
+			}
+		})
+	}
+}
+
+func TestPrivacySalt(t *testing.T) {
+	isolateSettings(t)
+	t.Setenv("CLOG_PRIVACY", "hash")
+	s, err := ResolveSettings("", Baked{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, first, err := PrivacyOptions(s)
+	if err != nil || len(first) == 0 {
+		t.Fatalf("PrivacyOptions() salt = %q, %v", first, err)
+	}
+	_, second, _ := PrivacyOptions(s)
+	if string(first) != string(second) {
+		t.Error("the machine salt changed between runs")
+	}
+
+	t.Setenv("CLOG_PRIVACY_SALT", "team-salt")
+	s, _ = ResolveSettings("", Baked{})
+	if _, salt, _ := PrivacyOptions(s); string(salt) != "team-salt" {
+		t.Errorf("salt = %q, want privacy_salt", salt)
+	}
+	if !s.Options["privacy_salt"].Secret {
+		t.Error("privacy_salt should be secret")
+	}
+}
+
+func TestPrivacyPublisher(t *testing.T) {
+	event := Event{Type: "task", State: "in_progress", Message: "Adding VAT", UserPrompt: "Add VAT to the invoice API", SessionID: "s1"}
+
+	tests := []struct {
+		name  string
+		level string
+		event Event
+		check func(t *testing.T, got Message)
+	}{
+		{
+			name:  "omit",
+			level: PrivacyOmit,
+			event: event,
+			check: func(t *testing.T, got Message) {
+				if got.Privacy != PrivacyOmit || got.UserPrompt != "" || got.Message != "Adding VAT" || got.MessageLength != 0 {
+					t.Errorf("published %+v", got)
+				}
+			},
+		},
+		{
+			name:  "hash",
+			level: PrivacyHash,
+			event: event,
+			check: func(t *testing.T, got Message) {
+				if got.Privacy != PrivacyHash || got.MessageLength != 10 || got.UserPromptLength != 26 {
+					t.Errorf("published %+v", got)
+				}
+				for _, hashed := range []string{got.Message, got.UserPrompt} {
+					if !strings.HasPrefix(hashed, "sha256:") || len(hashed) != len("sha256:")+64 {
+						t.Errorf("%q is not a hash", hashed)
+					}
+				}
+				if got.SessionID != "s1" || got.State != "in_progress" {
+					t.Errorf("published %+v, want session and state kept", got)
+				}
+			},
+		},
+		{
+			name:  "hash without prompt",
+			level: PrivacyHash,
+			event: Event{Type: "progress", Message: "5/10 — done"},
+			check: func(t *testing.T, got Message) {
+				if got.UserPrompt != "" || got.UserPromptLength != 0 || got.MessageLength != 11 {
+					t.Errorf("published %+v", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Message
+			p := NewPrivacyPublisher(publisherFunc(func(_ context.Context, e Event) error {
+				got = e.Payload()
+				return nil
+			}), tt.level, []byte("salt"))
+			if err := p.Publish(context.Background(), tt.event); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, got)
+		})
+	}
+
+	// Hashes match for equal text and salt only
+	hash := func(salt, text string) string {
+		var got Event
+		p := NewPrivacyPublisher(publisherFunc(func(_ context.Context, e Event) error {
+			got = e
+			return nil
+		}), PrivacyHash, []byte(salt))
+		p.Publish(context.Background(), Event{Type: "progress", Message: text})
+		return got.Message
+	}
+	if hash("a", "x") != hash("a", "x") || hash("a", "x") == hash("b", "x") || hash("a", "x") == hash("a", "y") {
+		t.Error("hashes should depend on exactly the salt and text")
+	}
+
+	p := NewPrivacyPublisher(publisherFunc(func(context.Context, Event) error { return nil }), PrivacyHash, []byte("salt"))
+	if err := p.Publish(context.Background(), Event{Type: "task"}); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Publish() without message error = %v, want ErrInvalidEvent", err)
+	}
+	if err := p.Publish(context.Background(), Event{Type: "task", Message: "m", AttachPaths: []string{"plan.md"}}); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Publish() with an attachment error = %v, want ErrInvalidEvent", err)
+	}
+}
@@ -0,0 +1,156 @@
+package clog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+)
+
+// ErrSessionScope marks an event for a session the credentials may not publish
+var ErrSessionScope = errors.New("credentials are scoped to session")
+
+// How long to wait for the server to confirm a publish when the context has
+// no deadline
+const publishTimeout = 5 * time.Second
+
+// Publisher sends clog events
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// NATSPublisher publishes events as JSON messages on a NATS connection
+type NATSPublisher struct {
+	nc    *nats.Conn
+	scope string
+
+	// Format selects the encoding; binary CloudEvents attributes are sent as
+	// NATS headers
+	Format Format
+
+	// Compression compresses big payloads, noted in a Content-Encoding header
+	Compression Compression
+}
+
+// NewNATSPublisher publishes on nc, which the caller keeps ownership of. Pass
+// the claims returned by Connect so credentials minted for one session (see
+// MintCreds) publish to that session's subjects.
+func NewNATSPublisher(nc *nats.Conn, claims *jwt.UserClaims) *NATSPublisher {
+	return &NATSPublisher{nc: nc, scope: SessionScope(claims)}
+}
+
+// Publish validates the event, publishes it and waits for the server to
+// accept it
+func (p *NATSPublisher) Publish(ctx context.Context, e Event) error {
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	e, subject, err := applyScope(e, p.scope)
+	if err != nil {
+		return err
+	}
+
+	// JetStream streams drop repeats of a Nats-Msg-Id within their duplicate
+	// window
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+	data, headers, err := p.encode(e)
+	if err != nil {
+		return err
+	}
+
+	// Too big for the server: the full payload goes to the object store and
+	// a preview is published. The server's limit covers the headers too.
+	msg := newMessage(subject, e.ID, data, headers)
+	if max, size := p.nc.MaxPayload(), messageSize(msg); max > 0 && int64(size) > max {
+		if e, err = offloadPayload(ctx, p.nc, e); err != nil {
+			return fmt.Errorf("message of %d bytes exceeds the server's max_payload (%d) and could not be offloaded: %w", size, max, err)
+		}
+		if data, headers, err = p.encode(e); err != nil {
+			return err
+		}
+		msg = newMessage(subject, e.ID, data, headers)
+	}
+	return publishMessage(ctx, p.nc, msg)
+}
+
+// newMessage builds the NATS message for an encoded event, with its ID as
+// the Nats-Msg-Id header
+func newMessage(subject, id string, data []byte, headers map[string]string) *nats.Msg {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	for name, value := range headers {
+		msg.Header.Set(name, value)
+	}
+	msg.Header.Set(nats.MsgIdHdr, id)
+	return msg
+}
+
+// messageSize is the number of bytes the server counts against max_payload:
+// the data plus the headers as sent, "NATS/1.0\r\n", one "name: value\r\n"
+// line per value and a closing "\r\n"
+func messageSize(msg *nats.Msg) int {
+	size := len(msg.Data)
+	if len(msg.Header) == 0 {
+		return size
+	}
+	size += len("NATS/1.0\r\n") + len("\r\n")
+	for name, values := range msg.Header {
+		for _, value := range values {
+			size += len(name) + len(": ") + len(value) + len("\r\n")
+		}
+	}
+	return size
+}
+
+// encode encodes the event in the publisher's format, compressed if it is
+// big enough
+func (p *NATSPublisher) encode(e Event) ([]byte, map[string]string, error) {
+	data, headers, err := p.Format.encode(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.Compression.apply(data, headers)
+}
+
+// applyScope returns the event and subject to publish with credentials
+// scoped to a session, or the event's own subject when scope is ""
+func applyScope(e Event, scope string) (Event, string, error) {
+	if scope == "" {
+		return e, e.Subject(), nil
+	}
+	if e.SessionID != "" && e.SessionID != scope {
+		return e, e.Subject(), fmt.Errorf("%w '%s', not '%s'", ErrSessionScope, scope, e.SessionID)
+	}
+	e.SessionID = scope
+	return e, e.Subject() + "." + scope, nil
+}
+
+// publishMessage publishes a message to NATS and waits for the flush
+func publishMessage(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+	subject := msg.Subject
+	if err := nc.PublishMsg(msg); err != nil {
+		return fmt.Errorf("failed to publish message to subject '%s': %w", subject, err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+	}
+	if err := nc.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("message delivery timeout: %w", err)
+	}
+
+	// Permission violations arrive asynchronously, ahead of the flush PONG
+	if err := nc.LastError(); err != nil && IsAuthRejection(err) {
+		return fmt.Errorf("publish to subject '%s' rejected: %w", subject, err)
+	}
+
+	return nil
+}
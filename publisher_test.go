@@ -0,0 +1,121 @@
+package clog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// connectTestServer runs an embedded nats-server for the duration of a test
+// and returns a connection to it
+func connectTestServer(t *testing.T) *nats.Conn {
+	t.Helper()
+	return startTestServer(t, &server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+}
+
+// connectJetStreamServer is connectTestServer with JetStream enabled
+func connectJetStreamServer(t *testing.T) *nats.Conn {
+	t.Helper()
+	return startTestServer(t, &server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true, JetStream: true, StoreDir: t.TempDir()})
+}
+
+func startTestServer(t *testing.T, opts *server.Options) *nats.Conn {
+	t.Helper()
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		t.Fatalf("server.NewServer() error = %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("embedded server not ready")
+	}
+	t.Cleanup(func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	})
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("nats.Connect() error = %v", err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func TestNATSPublisherPublish(t *testing.T) {
+	nc := connectTestServer(t)
+	sub, err := nc.SubscribeSync("claude.>")
+	if err != nil {
+		t.Fatalf("SubscribeSync() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		scope       string
+		event       Event
+		wantSubject string
+		wantSession string
+		wantErr     error
+	}{
+		{
+			name:        "unscoped",
+			event:       Event{Type: "task", State: "in_progress", Message: "Start", SessionID: "s1"},
+			wantSubject: "claude.tasks.started",
+			wantSession: "s1",
+		},
+		{
+			name:        "scoped fills in the session",
+			scope:       "agent-1",
+			event:       Event{Type: "progress", Message: "Halfway"},
+			wantSubject: "claude.progress.update.agent-1",
+			wantSession: "agent-1",
+		},
+		{
+			name:    "scoped to another session",
+			scope:   "agent-1",
+			event:   Event{Type: "progress", Message: "Halfway", SessionID: "agent-2"},
+			wantErr: ErrSessionScope,
+		},
+		{
+			name:    "invalid event",
+			event:   Event{Type: "note", Message: "Hello"},
+			wantErr: ErrInvalidEvent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &NATSPublisher{nc: nc, scope: tt.scope}
+			err := p.Publish(context.Background(), tt.event)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Publish() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+
+			msg, err := sub.NextMsg(time.Second)
+			if err != nil {
+				t.Fatalf("NextMsg() error = %v", err)
+			}
+			if msg.Subject != tt.wantSubject {
+				t.Errorf("subject = %q, want %q", msg.Subject, tt.wantSubject)
+			}
+			var got Message
+			if err := json.Unmarshal(msg.Data, &got); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if got.SessionID != tt.wantSession || got.Message != tt.event.Message {
+				t.Errorf("payload = %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package clog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What happens to events over a rate limit
+const (
+	// RateLimitCoalesce holds back the latest excess event and publishes it
+	// once its limit allows, with the next clog call for any session (the
+	// default)
+	RateLimitCoalesce = "coalesce"
+	// RateLimitDrop discards excess events
+	RateLimitDrop = "drop"
+)
+
+// RateLimit allows Count events of one type per session within Per
+type RateLimit struct {
+	Type  string
+	Count int
+	Per   time.Duration
+}
+
+// String renders the limit the way it is written in the rate_limit setting
+func (l RateLimit) String() string {
+	return fmt.Sprintf("%s=%d/%s", l.Type, l.Count, l.Per)
+}
+
+// ParseRateLimits parses a comma-separated rate_limit setting such as
+// "progress=1/10s,session=4/1m". Task and question events are never limited.
+func ParseRateLimits(spec string) ([]RateLimit, error) {
+	var limits []RateLimit
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		eventType, rate, ok := strings.Cut(entry, "=")
+		count, per, ok2 := strings.Cut(rate, "/")
+		n, err := strconv.Atoi(count)
+		d, err2 := time.ParseDuration(per)
+		if !ok || !ok2 || err != nil || err2 != nil || n < 1 || d <= 0 {
+			return nil, fmt.Errorf("%w: rate limit '%s' must look like progress=1/10s", ErrInvalidConfig, entry)
+		}
+		switch {
+		case eventType == "task" || eventType == "question":
+			return nil, fmt.Errorf("%w: %s events cannot be rate limited", ErrInvalidConfig, eventType)
+		case !validTypes[eventType]:
+			return nil, fmt.Errorf("%w: rate limit for unknown type '%s'", ErrInvalidConfig, eventType)
+		}
+		limits = append(limits, RateLimit{Type: eventType, Count: n, Per: d})
+	}
+	return limits, nil
+}
+
+// RateLimitOptions returns the limits configured by rate_limit and what
+// happens to excess events (rate_limit_mode), or no limits when unset
+func RateLimitOptions(s Settings) ([]RateLimit, string, error) {
+	limits, err := ParseRateLimits(s.Options["rate_limit"].Value)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mode := s.Options["rate_limit_mode"].Value
+	switch mode {
+	case "":
+		mode = RateLimitCoalesce
+	case RateLimitCoalesce, RateLimitDrop:
+	default:
+		return nil, "", fmt.Errorf("%w: invalid rate_limit_mode '%s'. Must be: coalesce|drop", ErrInvalidConfig, mode)
+	}
+	return limits, mode, nil
+}
+
+// rateState is what clog remembers about a session's recent events:
+// publish times per limited type, and the latest held-back event per type
+type rateState struct {
+	Sent    map[string][]time.Time `json:"sent,omitempty"`
+	Pending map[string]Event       `json:"pending,omitempty"`
+}
+
+// RateLimitPublisher limits how often each session publishes events of the
+// limited types. Excess events are dropped or, when coalescing, the latest
+// one is held back: a later excess event of the same type replaces it, and
+// it is published ahead of the next event once its limit allows, or ahead of
+// the session's next event of another type. Held events live in the user
+// cache directory, so one is only published if clog runs again.
+type RateLimitPublisher struct {
+	next   Publisher
+	limits map[string]RateLimit
+	mode   string
+	dir    string
+
+	// OnLimited, if set, is called for each event over its limit; held
+	// reports whether it was kept for coalescing rather than dropped
+	OnLimited func(e Event, limit RateLimit, held bool)
+
+	// OnError, if set, is called when the rate state cannot be used or a
+	// held-back event cannot be published. Events are published regardless.
+	OnError func(err error)
+}
+
+// NewRateLimitPublisher applies limits (with mode RateLimitCoalesce or
+// RateLimitDrop) before publishing through next, keeping state in the user
+// cache directory
+func NewRateLimitPublisher(next Publisher, limits []RateLimit, mode string) *RateLimitPublisher {
+	byType := map[string]RateLimit{}
+	for _, limit := range limits {
+		byType[limit.Type] = limit
+	}
+	return &RateLimitPublisher{next: next, limits: byType, mode: mode}
+}
+
+// Publish publishes the event unless it is over its limit, first publishing
+// held-back events that are due and, when the event is of another type,
+// whatever its session held back
+func (p *RateLimitPublisher) Publish(ctx context.Context, e Event) error {
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	// Held events from any session whose limit allows them again go first
+	held, err := p.due(ctx)
+	if err != nil && p.OnError != nil {
+		p.OnError(err)
+	}
+
+	var limited bool
+	limit, hasLimit := p.limits[e.Type]
+	err = p.update(ctx, e.SessionID, func(state *rateState) {
+		now := time.Now()
+		for eventType, sent := range state.Sent {
+			state.Sent[eventType] = recentTimes(sent, now, p.limits[eventType].Per)
+		}
+
+		if !hasLimit {
+			// Nothing held back is lost when, say, the session ends
+			for eventType, pending := range state.Pending {
+				held = append(held, pending)
+				state.Sent[eventType] = append(state.Sent[eventType], now)
+			}
+			state.Pending = map[string]Event{}
+			return
+		}
+		if len(state.Sent[e.Type]) < limit.Count {
+			// A held event another clog process did not get to goes first
+			if pending, ok := state.Pending[e.Type]; ok {
+				held = append(held, pending)
+				delete(state.Pending, e.Type)
+			}
+			state.Sent[e.Type] = append(state.Sent[e.Type], now)
+			return
+		}
+		limited = true
+		if p.mode == RateLimitCoalesce {
+			state.Pending[e.Type] = e
+		}
+	})
+	if err != nil && p.OnError != nil {
+		p.OnError(err)
+	}
+
+	sort.Slice(held, func(i, j int) bool { return held[i].Timestamp.Before(held[j].Timestamp) })
+	for _, pending := range held {
+		if err := p.next.Publish(ctx, pending); err != nil && p.OnError != nil {
+			p.OnError(fmt.Errorf("held-back %s event not published: %w", pending.Type, err))
+		}
+	}
+
+	if limited {
+		if p.OnLimited != nil {
+			p.OnLimited(e, limit, p.mode == RateLimitCoalesce)
+		}
+		return nil
+	}
+	return p.next.Publish(ctx, e)
+}
+
+// due takes the held-back events of every session whose type has room under
+// its limit again, recording them as sent, so a session whose last event was
+// held back still has it published after a quiet interval
+func (p *RateLimitPublisher) due(ctx context.Context) ([]Event, error) {
+	dir, err := p.stateDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var due []Event
+	for _, path := range paths {
+		err := p.updateFile(ctx, path, func(state *rateState) {
+			now := time.Now()
+			for eventType, sent := range state.Sent {
+				state.Sent[eventType] = recentTimes(sent, now, p.limits[eventType].Per)
+			}
+			for eventType, pending := range state.Pending {
+				if limit, ok := p.limits[eventType]; ok && len(state.Sent[eventType]) >= limit.Count {
+					continue
+				}
+				due = append(due, pending)
+				state.Sent[eventType] = append(state.Sent[eventType], now)
+				delete(state.Pending, eventType)
+			}
+		})
+		if err != nil {
+			return due, err
+		}
+	}
+	return due, nil
+}
+
+// stateDir returns the directory holding each session's rate state
+func (p *RateLimitPublisher) stateDir() (string, error) {
+	dir := p.dir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("no cache directory for rate limits: %w", err)
+		}
+		dir = filepath.Join(cache, "clog", "ratelimit")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// update applies fn to the session's rate state under its lock and saves the
+// result, removing the file once there is nothing left to remember
+func (p *RateLimitPublisher) update(ctx context.Context, sessionID string, fn func(*rateState)) error {
+	dir, err := p.stateDir()
+	if err != nil {
+		return err
+	}
+	return p.updateFile(ctx, filepath.Join(dir, sessionKey(sessionID)+".json"), fn)
+}
+
+// updateFile is update for the state file at path
+func (p *RateLimitPublisher) updateFile(ctx context.Context, path string, fn func(*rateState)) error {
+	unlock, err := lockFile(ctx, path+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state := &rateState{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// A corrupt state file only forgets recent publishes; start afresh
+	if len(data) > 0 && json.Unmarshal(data, state) != nil {
+		state = &rateState{}
+	}
+	if state.Sent == nil {
+		state.Sent = map[string][]time.Time{}
+	}
+	if state.Pending == nil {
+		state.Pending = map[string]Event{}
+	}
+
+	fn(state)
+
+	for eventType, sent := range state.Sent {
+		if len(sent) == 0 {
+			delete(state.Sent, eventType)
+		}
+	}
+	if len(state.Sent) == 0 && len(state.Pending) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err = json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// recentTimes keeps the times within per of now
+func recentTimes(times []time.Time, now time.Time, per time.Duration) []time.Time {
+	recent := times[:0]
+	for _, t := range times {
+		if now.Sub(t) < per {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
@@ -0,0 +1,182 @@
+package clog
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []RateLimit
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "progress=1/10s", want: []RateLimit{{Type: "progress", Count: 1, Per: 10 * time.Second}}},
+		{spec: "progress=6/1m, session=2/1h", want: []RateLimit{{Type: "progress", Count: 6, Per: time.Minute}, {Type: "session", Count: 2, Per: time.Hour}}},
+		{spec: "task=1/10s", wantErr: true},
+		{spec: "question=1/10s", wantErr: true},
+		{spec: "chatter=1/10s", wantErr: true},
+		{spec: "progress=0/10s", wantErr: true},
+		{spec: "progress=1", wantErr: true},
+		{spec: "progress", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseRateLimits(tt.spec)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("ParseRateLimits() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("ParseRateLimits() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitPublisher(t *testing.T) {
+	progress := func(message string) Event {
+		return Event{Type: "progress", Message: message, SessionID: "s1"}
+	}
+	tests := []struct {
+		name        string
+		mode        string
+		events      []Event
+		sleepBefore map[int]time.Duration
+		want        []string
+		wantLimited int
+	}{
+		{
+			name: "coalesce publishes the latest before other events",
+			mode: RateLimitCoalesce,
+			events: []Event{
+				progress("p1"), progress("p2"), progress("p3"),
+				{Type: "task", State: "completed", Message: "done", SessionID: "s1"},
+			},
+			want:        []string{"p1", "p3", "done"},
+			wantLimited: 2,
+		},
+		{
+			name:        "coalesce publishes the held event once the limit allows",
+			mode:        RateLimitCoalesce,
+			events:      []Event{progress("p1"), progress("p2"), progress("p3")},
+			sleepBefore: map[int]time.Duration{2: 150 * time.Millisecond},
+			want:        []string{"p1", "p2"},
+			wantLimited: 2,
+		},
+		{
+			name: "coalesce publishes a session's last event with another session's",
+			mode: RateLimitCoalesce,
+			events: []Event{
+				progress("p1"), progress("final"),
+				{Type: "progress", Message: "other", SessionID: "s2"},
+				{Type: "question", Message: "ok?", SessionID: "s3"},
+			},
+			sleepBefore: map[int]time.Duration{3: 150 * time.Millisecond},
+			want:        []string{"p1", "other", "final", "ok?"},
+			wantLimited: 1,
+		},
+		{
+			name: "drop discards excess events",
+			mode: RateLimitDrop,
+			events: []Event{
+				progress("p1"), progress("p2"),
+				{Type: "question", State: "blocked", Message: "ok?", SessionID: "s1"},
+			},
+			want:        []string{"p1", "ok?"},
+			wantLimited: 1,
+		},
+		{
+			name:   "sessions are limited separately",
+			mode:   RateLimitDrop,
+			events: []Event{progress("p1"), {Type: "progress", Message: "other", SessionID: "s2"}},
+			want:   []string{"p1", "other"},
+		},
+		{
+			name: "tasks and questions are never limited",
+			mode: RateLimitDrop,
+			events: []Event{
+				{Type: "task", State: "in_progress", Message: "t1", SessionID: "s1"},
+				{Type: "task", State: "completed", Message: "t2", SessionID: "s1"},
+				{Type: "question", Message: "q1", SessionID: "s1"},
+				{Type: "question", Message: "q2", SessionID: "s1"},
+			},
+			want: []string{"t1", "t2", "q1", "q2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var published []string
+			next := publisherFunc(func(_ context.Context, e Event) error {
+				published = append(published, e.Message)
+				return nil
+			})
+			p := NewRateLimitPublisher(next, []RateLimit{{Type: "progress", Count: 1, Per: 100 * time.Millisecond}}, tt.mode)
+			p.dir = t.TempDir()
+			limited := 0
+			p.OnLimited = func(_ Event, _ RateLimit, held bool) {
+				limited++
+				if held != (tt.mode == RateLimitCoalesce) {
+					t.Errorf("held = %v in mode %s", held, tt.mode)
+				}
+			}
+			p.OnError = func(err error) { t.Errorf("rate limit error: %v", err) }
+
+			for i, e := range tt.events {
+				time.Sleep(tt.sleepBefore[i])
+				if err := p.Publish(context.Background(), e); err != nil {
+					t.Fatalf("Publish() error = %v", err)
+				}
+			}
+			if !slices.Equal(published, tt.want) {
+				t.Errorf("published %q, want %q", published, tt.want)
+			}
+			if limited != tt.wantLimited {
+				t.Errorf("limited %d events, want %d", limited, tt.wantLimited)
+			}
+		})
+	}
+}
+
+func TestRateLimitOptions(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    string
+		wantErr bool
+	}{
+		{mode: "", want: RateLimitCoalesce},
+		{mode: "drop", want: RateLimitDrop},
+		{mode: "queue", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			isolateSettings(t)
+			t.Setenv("CLOG_RATE_LIMIT", "progress=1/10s")
+			t.Setenv("CLOG_RATE_LIMIT_MODE", tt.mode)
+			s, err := ResolveSettings("", Baked{})
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+
+			limits, mode, err := RateLimitOptions(s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("RateLimitOptions() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil || mode != tt.want || len(limits) != 1 {
+				t.Errorf("RateLimitOptions() = %v, %q, %v, want one limit and mode %q", limits, mode, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package clog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactRule replaces text matching Pattern with "[REDACTED:<Name>]". When
+// the pattern has a capture group, only the first group is replaced, so
+// "password: hunter2" can keep its label.
+type RedactRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// BuiltinRedactRules are the detectors applied unless redact is "off"
+var BuiltinRedactRules = []RedactRule{
+	{Name: "private_key", Pattern: regexp.MustCompile(`-----BEGIN[A-Z ]*PRIVATE KEY-----[\s\S]*?-----END[A-Z ]*PRIVATE KEY-----`)},
+	{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "aws_secret_key", Pattern: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`)},
+	{Name: "github_token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{Name: "password", Pattern: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd)\s*[:=]\s*["']?([^\s"']+)`)},
+	{Name: "email", Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+}
+
+// RedactOptions returns the rules configured by redact and redact_rules: the
+// built-in detectors unless redact is "off", followed by the user's rules.
+// redact_rules holds one name=regex per line, or "@path" to read them from
+// a file where blank lines and lines starting with # are ignored.
+func RedactOptions(s Settings) ([]RedactRule, error) {
+	var rules []RedactRule
+	switch mode := s.Options["redact"].Value; mode {
+	case "", "on":
+		rules = append(rules, BuiltinRedactRules...)
+	case "off":
+	default:
+		return nil, fmt.Errorf("%w: invalid redact '%s'. Must be: on|off", ErrInvalidConfig, mode)
+	}
+
+	spec := s.Options["redact_rules"].Value
+	if path, ok := strings.CutPrefix(spec, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: redact_rules: %v", ErrInvalidConfig, err)
+		}
+		spec = string(data)
+	}
+	custom, err := ParseRedactRules(spec)
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, custom...), nil
+}
+
+// ParseRedactRules parses name=regex rules, one per line
+func ParseRedactRules(spec string) ([]RedactRule, error) {
+	var rules []RedactRule
+	for _, line := range strings.Split(spec, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, expr, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || expr == "" {
+			return nil, fmt.Errorf("%w: redact rule '%s' must look like name=regex", ErrInvalidConfig, line)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: redact rule '%s': %v", ErrInvalidConfig, name, err)
+		}
+		rules = append(rules, RedactRule{Name: name, Pattern: pattern})
+	}
+	return rules, nil
+}
+
+// Redact replaces whatever the rules match in text, returning the result and
+// how many matches each rule replaced. Rules apply in order, so a later rule
+// never sees what an earlier one redacted.
+func Redact(text string, rules []RedactRule) (string, map[string]int) {
+	counts := map[string]int{}
+	for _, rule := range rules {
+		var b strings.Builder
+		last, replaced := 0, false
+		for _, m := range rule.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if len(m) > 2 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			// Empty matches and earlier redactions are left alone
+			if start == end || strings.HasPrefix(text[start:end], "[REDACTED:") {
+				continue
+			}
+			b.WriteString(text[last:start])
+			b.WriteString("[REDACTED:" + rule.Name + "]")
+			last, replaced = end, true
+			counts[rule.Name]++
+		}
+		if replaced {
+			b.WriteString(text[last:])
+			text = b.String()
+		}
+	}
+	return text, counts
+}
+
+// RedactPublisher removes secrets and personal data from an event's message
+// and user prompt before anything else sees it, recording how many matches
+// were replaced in the event's Redactions
+type RedactPublisher struct {
+	next  Publisher
+	rules []RedactRule
+
+	// OnRedact, if set, is called with the number of matches per rule when
+	// anything was redacted
+	OnRedact func(counts map[string]int)
+}
+
+// NewRedactPublisher applies rules before publishing through next
+func NewRedactPublisher(next Publisher, rules []RedactRule) *RedactPublisher {
+	return &RedactPublisher{next: next, rules: rules}
+}
+
+// Publish redacts the event's message and user prompt, then publishes it
+func (p *RedactPublisher) Publish(ctx context.Context, e Event) error {
+	message, counts := Redact(e.Message, p.rules)
+	prompt, promptCounts := Redact(e.UserPrompt, p.rules)
+	for name, n := range promptCounts {
+		counts[name] += n
+	}
+	e.Message, e.UserPrompt = message, prompt
+
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total > 0 {
+		e.Redactions += total
+		if p.OnRedact != nil {
+			p.OnRedact(counts)
+		}
+	}
+	return p.next.Publish(ctx, e)
+}
+
+// RedactionSummary renders counts as "2 email, 1 github_token"
+func RedactionSummary(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[name], name))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,47 @@
+package clog
+
+import "fmt"
+
+// EventSchema returns a JSON Schema for the fields of an event of the given
+// type, named as in Message, built from the rules Validate applies
+func EventSchema(eventType string) map[string]any {
+	properties := map[string]any{
+		"message": map[string]any{
+			"type":        "string",
+			"minLength":   1,
+			"description": "What happened or what you are doing",
+		},
+		"user_prompt": map[string]any{
+			"type":        "string",
+			"description": "The user's input, as an EXACT, VERBATIM copy (do not summarize or paraphrase)",
+		},
+		"task_num": map[string]any{
+			"type":        "string",
+			"description": `Current task number, e.g. "3/15"`,
+		},
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "Session identifier (any string)",
+		},
+		"id": map[string]any{
+			"type":        "string",
+			"maxLength":   maxIDLength,
+			"pattern":     `^[^\s\x00-\x1f\x7f]*$`,
+			"description": "Message ID; send the same one when retrying so repeats are dropped",
+		},
+	}
+	if states := statesByType[eventType]; len(states) > 0 {
+		properties["state"] = map[string]any{
+			"type":        "string",
+			"enum":        ValidStates(eventType),
+			"description": fmt.Sprintf("State of the %s", eventType),
+		}
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             []string{"message"},
+		"additionalProperties": false,
+	}
+}
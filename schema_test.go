@@ -0,0 +1,42 @@
+package clog
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEventSchema(t *testing.T) {
+	tests := []struct {
+		eventType  string
+		wantStates []string
+	}{
+		{eventType: "task", wantStates: []string{"pending", "in_progress", "blocked", "completed"}},
+		{eventType: "question", wantStates: []string{"blocked"}},
+		{eventType: "progress", wantStates: nil},
+		{eventType: "session", wantStates: []string{"in_progress", "completed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			schema := EventSchema(tt.eventType)
+			properties := schema["properties"].(map[string]any)
+			if !slices.Equal(schema["required"].([]string), []string{"message"}) {
+				t.Errorf("required = %v, want message", schema["required"])
+			}
+			if id := properties["id"].(map[string]any); id["maxLength"] != maxIDLength {
+				t.Errorf("id maxLength = %v, want %d", id["maxLength"], maxIDLength)
+			}
+
+			state, ok := properties["state"].(map[string]any)
+			if tt.wantStates == nil {
+				if ok {
+					t.Errorf("state = %v, want no state property", state)
+				}
+				return
+			}
+			if !ok || !slices.Equal(state["enum"].([]string), tt.wantStates) {
+				t.Errorf("state = %v, want enum %v", state, tt.wantStates)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package clog
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeySourceMachine selects a key derived from the machine ID instead of a file
+const KeySourceMachine = "machine"
+
+// HKDF info string; bump the version if the sealing format changes
+const sealInfo = "clog baked credentials v1"
+
+// ErrMissingKey marks a baked secret that cannot be decrypted on this machine
+var ErrMissingKey = errors.New("decryption key unavailable")
+
+// keyFilePath returns the key file to use at runtime for a key source
+func keyFilePath(keySource string) string {
+	if path := os.Getenv("CLOG_KEY_FILE"); path != "" {
+		return path
+	}
+	return keySource
+}
+
+// ReadKeyMaterial returns the secret input for key derivation
+func ReadKeyMaterial(keySource string) ([]byte, error) {
+	if keySource == KeySourceMachine && os.Getenv("CLOG_KEY_FILE") == "" {
+		id, err := machineID()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMissingKey, err)
+		}
+		return []byte(id), nil
+	}
+
+	path := keyFilePath(keySource)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key file %s: %v (set CLOG_KEY_FILE to its location)", ErrMissingKey, path, err)
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: key file %s is empty", ErrMissingKey, path)
+	}
+	return data, nil
+}
+
+// machineID returns a stable identifier for this machine
+func machineID() (string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+			if data, err := os.ReadFile(path); err == nil && len(bytes.TrimSpace(data)) > 0 {
+				return strings.TrimSpace(string(data)), nil
+			}
+		}
+		return "", errors.New("no machine ID found in /etc/machine-id")
+	case "darwin":
+		out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err != nil {
+			return "", fmt.Errorf("reading IOPlatformUUID: %w", err)
+		}
+		match := regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`).FindSubmatch(out)
+		if match == nil {
+			return "", errors.New("no IOPlatformUUID in ioreg output")
+		}
+		return string(match[1]), nil
+	}
+	return "", fmt.Errorf("machine-bound keys are not supported on %s, use a key file", runtime.GOOS)
+}
+
+// EnsureKeyFile creates a random key file if one does not exist yet
+func EnsureKeyFile(path string) (bool, error) {
+	if path == KeySourceMachine {
+		return false, nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600)
+}
+
+// sealCipher derives the AES-GCM cipher for key material and salt
+func sealCipher(material, salt []byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, material, salt, []byte(sealInfo)), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealSecrets encrypts secret values as base64(salt || nonce || ciphertext)
+func SealSecrets(secrets map[string]string, material []byte) (string, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := sealCipher(material, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := append(append(salt, nonce...), aead.Seal(nil, nonce, plaintext, nil)...)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// unsealSecrets reverses SealSecrets
+func unsealSecrets(sealed string, material []byte) (map[string]string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("sealed credentials are corrupt: %w", err)
+	}
+	if len(data) < 16 {
+		return nil, errors.New("sealed credentials are corrupt: too short")
+	}
+
+	aead, err := sealCipher(material, data[:16])
+	if err != nil {
+		return nil, err
+	}
+	data = data[16:]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("sealed credentials are corrupt: too short")
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong key for sealed credentials", ErrMissingKey)
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("sealed credentials are corrupt: %w", err)
+	}
+	return secrets, nil
+}
+
+// unsealBaked fills in sealed baked secrets for a connection attempt
+func unsealBaked(s Settings) (Settings, error) {
+	material, err := ReadKeyMaterial(s.baked.KeySource)
+	if err != nil {
+		return s, err
+	}
+	secrets, err := unsealSecrets(s.baked.Sealed, material)
+	if err != nil {
+		return s, err
+	}
+
+	auth := make(map[string]Setting, len(s.Auth))
+	for field, value := range s.Auth {
+		if value.Sealed {
+			value.Value = secrets[field]
+		}
+		auth[field] = value
+	}
+	s.Auth = auth
+	return s, nil
+}
@@ -0,0 +1,81 @@
+package clog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSealSecretsRoundTrip(t *testing.T) {
+	secrets := map[string]string{"password": "hunter2", "token": ""}
+
+	sealed, err := SealSecrets(secrets, []byte("key material"))
+	if err != nil {
+		t.Fatalf("SealSecrets() error = %v", err)
+	}
+	if strings.Contains(sealed, "hunter2") {
+		t.Error("sealed blob contains the plaintext secret")
+	}
+
+	got, err := unsealSecrets(sealed, []byte("key material"))
+	if err != nil {
+		t.Fatalf("unSealSecrets() error = %v", err)
+	}
+	if got["password"] != "hunter2" {
+		t.Errorf("password = %q, want hunter2", got["password"])
+	}
+
+	if _, err := unsealSecrets(sealed, []byte("other key")); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("unsealSecrets() with wrong key error = %v, want ErrMissingKey", err)
+	}
+	if _, err := unsealSecrets("bm9wZQ==", []byte("key material")); err == nil {
+		t.Error("unsealSecrets() with truncated blob should fail")
+	}
+}
+
+func TestSealedBakedCredentials(t *testing.T) {
+	isolateSettings(t)
+	t.Setenv("CLOG_KEY_FILE", "")
+
+	keyFile := filepath.Join(t.TempDir(), "clog.key")
+	if _, err := EnsureKeyFile(keyFile); err != nil {
+		t.Fatalf("EnsureKeyFile() error = %v", err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file not created with mode 0600: %v", err)
+	}
+	material, err := ReadKeyMaterial(keyFile)
+	if err != nil {
+		t.Fatalf("ReadKeyMaterial() error = %v", err)
+	}
+	sealed, err := SealSecrets(map[string]string{"password": "hunter2"}, material)
+	if err != nil {
+		t.Fatalf("SealSecrets() error = %v", err)
+	}
+	baked := Baked{URL: "nats://127.0.0.1:1", AuthType: "userpass", Username: "u", Sealed: sealed, KeySource: keyFile}
+
+	s, err := ResolveSettings("", baked)
+	if err != nil {
+		t.Fatalf("ResolveSettings() error = %v", err)
+	}
+	if password := s.Auth["password"]; !password.Sealed || password.display() != "[encrypted]" {
+		t.Errorf("password = %+v, want sealed", password)
+	}
+
+	unsealed, err := unsealBaked(s)
+	if err != nil {
+		t.Fatalf("unsealBaked() error = %v", err)
+	}
+	if unsealed.Auth["password"].Value != "hunter2" || unsealed.Auth["username"].Value != "u" {
+		t.Errorf("unsealed auth = %+v", unsealed.Auth)
+	}
+
+	// A copied binary without its key file fails with a credential error
+	t.Setenv("CLOG_KEY_FILE", filepath.Join(t.TempDir(), "missing.key"))
+	_, _, err = Connect(s)
+	if !errors.Is(err, ErrInvalidCredentials) || !strings.Contains(err.Error(), "CLOG_KEY_FILE") {
+		t.Errorf("Connect() error = %v, want ErrInvalidCredentials naming CLOG_KEY_FILE", err)
+	}
+}
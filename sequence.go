@@ -0,0 +1,265 @@
+package clog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Sequence sources accepted in the sequence setting
+const (
+	// SequenceLocal keeps per-session counters in the user cache directory
+	SequenceLocal = "local"
+	// SequenceKV keeps per-session counters in a NATS JetStream KV bucket,
+	// shared by every machine publishing to the server
+	SequenceKV = "kv"
+	// SequenceOff publishes events without sequence numbers
+	SequenceOff = "off"
+)
+
+// SequenceBucket is the JetStream KV bucket used by the kv sequence source
+const SequenceBucket = "clog_sequences"
+
+// How long to wait for another clog process to release a lock file, such as
+// a session's counter, and how old a lock file must be before it is treated
+// as abandoned
+const (
+	lockFileTimeout = 2 * time.Second
+	lockFileStale   = 10 * time.Second
+)
+
+// Longest pause before retrying a KV counter update that lost a race
+const sequenceKVBackoff = 20 * time.Millisecond
+
+// SequenceOptions returns the sequence source configured by sequence,
+// defaulting to local
+func SequenceOptions(s Settings) (string, error) {
+	source := s.Options["sequence"].Value
+	switch source {
+	case "":
+		return SequenceLocal, nil
+	case SequenceLocal, SequenceKV, SequenceOff:
+		return source, nil
+	}
+	return "", fmt.Errorf("%w: invalid sequence '%s'. Must be: local|kv|off", ErrInvalidConfig, source)
+}
+
+// Sequencer hands out increasing sequence numbers per session, starting at 1
+type Sequencer interface {
+	Next(ctx context.Context, sessionID string) (uint64, error)
+}
+
+// SequencePublisher numbers each session's events before publishing them.
+// A number is used up even if the publish then fails, so consumers can spot
+// the missing event as a gap.
+type SequencePublisher struct {
+	next      Publisher
+	sequencer Sequencer
+
+	// OnError, if set, is called when no sequence number could be obtained.
+	// The event is still published, without one.
+	OnError func(err error)
+}
+
+// NewSequencePublisher numbers events with sequencer and publishes them
+// through next
+func NewSequencePublisher(next Publisher, sequencer Sequencer) *SequencePublisher {
+	return &SequencePublisher{next: next, sequencer: sequencer}
+}
+
+// Publish numbers events that have a session and no sequence number yet
+func (p *SequencePublisher) Publish(ctx context.Context, e Event) error {
+	if e.SessionID != "" && e.Seq == 0 {
+		// Invalid events would only waste a number
+		if err := e.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+		}
+		seq, err := p.sequencer.Next(ctx, e.SessionID)
+		if err != nil {
+			if p.OnError != nil {
+				p.OnError(err)
+			}
+		} else {
+			e.Seq = seq
+		}
+	}
+	return p.next.Publish(ctx, e)
+}
+
+// LocalSequencer keeps one counter file per session, locked so concurrent
+// clog processes on the machine never hand out the same number
+type LocalSequencer struct {
+	dir string
+}
+
+// NewLocalSequencer keeps counters in dir, or in the user cache directory
+// when dir is ""
+func NewLocalSequencer(dir string) *LocalSequencer {
+	return &LocalSequencer{dir: dir}
+}
+
+// Next increments and returns the session's counter
+func (q *LocalSequencer) Next(ctx context.Context, sessionID string) (uint64, error) {
+	dir := q.dir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return 0, fmt.Errorf("no cache directory for sequence numbers: %w", err)
+		}
+		dir = filepath.Join(cache, "clog", "sequences")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return 0, err
+	}
+	path := filepath.Join(dir, sessionKey(sessionID))
+
+	unlock, err := lockFile(ctx, path+".lock")
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	var seq uint64
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return 0, err
+	default:
+		seq, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("corrupt sequence file %s: %w", path, err)
+		}
+	}
+	seq++
+
+	// Write then rename, so a crash never leaves a truncated counter
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(seq, 10)+"\n"), 0o600); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// lockFile creates path exclusively, waiting for other holders to remove it,
+// and returns a function that releases the lock
+func lockFile(ctx context.Context, path string) (func(), error) {
+	deadline := time.Now().Add(lockFileTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		// A process that died holding the lock must not block the session forever
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockFileStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// KVSequencer keeps per-session counters in the clog_sequences JetStream KV
+// bucket, so every machine publishing for a session shares one sequence
+type KVSequencer struct {
+	nc *nats.Conn
+}
+
+// NewKVSequencer uses the KV bucket on nc's server, creating it if needed
+func NewKVSequencer(nc *nats.Conn) *KVSequencer {
+	return &KVSequencer{nc: nc}
+}
+
+// Next increments the session's counter with compare-and-swap, retrying after
+// a short random pause when another publisher got there first
+func (q *KVSequencer) Next(ctx context.Context, sessionID string) (uint64, error) {
+	if q.nc == nil {
+		return 0, errors.New("sequence kv needs a NATS connection")
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+	}
+
+	js, err := q.nc.JetStream(nats.Context(ctx))
+	if err != nil {
+		return 0, err
+	}
+	kv, err := js.KeyValue(SequenceBucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: SequenceBucket, Description: "clog per-session sequence numbers"})
+	}
+	if err != nil {
+		return 0, fmt.Errorf("sequence bucket %s: %w", SequenceBucket, err)
+	}
+
+	key := sessionKey(sessionID)
+	for {
+		entry, err := kv.Get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			_, err := kv.Create(key, []byte("1"))
+			if err == nil {
+				return 1, nil
+			}
+			if !errors.Is(err, nats.ErrKeyExists) {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		seq, err := strconv.ParseUint(string(entry.Value()), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("corrupt sequence for session %s: %w", sessionID, err)
+		}
+		seq++
+		_, err = kv.Update(key, []byte(strconv.FormatUint(seq, 10)), entry.Revision())
+		if err == nil {
+			return seq, nil
+		}
+		if !errors.Is(err, nats.ErrKeyExists) {
+			return 0, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("sequence for session %s: %w", sessionID, ctx.Err())
+		case <-time.After(time.Duration(rand.Int63n(int64(sequenceKVBackoff)))):
+		}
+	}
+}
+
+// sessionKey turns a session ID into a file name and KV key that is safe
+// whatever characters the ID contains
+func sessionKey(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,172 @@
+package clog
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestSequenceOptions(t *testing.T) {
+	tests := []struct {
+		sequence string
+		want     string
+		wantErr  bool
+	}{
+		{sequence: "", want: SequenceLocal},
+		{sequence: "local", want: SequenceLocal},
+		{sequence: "kv", want: SequenceKV},
+		{sequence: "off", want: SequenceOff},
+		{sequence: "redis", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sequence, func(t *testing.T) {
+			isolateSettings(t)
+			t.Setenv("CLOG_SEQUENCE", tt.sequence)
+			s, err := ResolveSettings("", Baked{})
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+
+			got, err := SequenceOptions(s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("SequenceOptions() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("SequenceOptions() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// testSequencer checks a sequencer counts each session from 1, including
+// under concurrent use
+func testSequencer(t *testing.T, sequencer Sequencer) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		session string
+		want    uint64
+	}{
+		{session: "s1", want: 1},
+		{session: "s1", want: 2},
+		{session: "s2", want: 1},
+		{session: "s1", want: 3},
+	} {
+		got, err := sequencer.Next(ctx, tt.session)
+		if err != nil || got != tt.want {
+			t.Fatalf("Next(%q) = %d, %v, want %d", tt.session, got, err, tt.want)
+		}
+	}
+
+	const workers = 20
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seqs []uint64
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seq, err := sequencer.Next(ctx, "concurrent")
+			if err != nil {
+				t.Errorf("Next() error = %v", err)
+				return
+			}
+			mu.Lock()
+			seqs = append(seqs, seq)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	slices.Sort(seqs)
+	for i, seq := range seqs {
+		if seq != uint64(i+1) {
+			t.Fatalf("concurrent seqs = %v, want 1-%d without gaps or repeats", seqs, workers)
+		}
+	}
+}
+
+func TestLocalSequencer(t *testing.T) {
+	testSequencer(t, NewLocalSequencer(t.TempDir()))
+}
+
+func TestKVSequencer(t *testing.T) {
+	testSequencer(t, NewKVSequencer(connectJetStreamServer(t)))
+
+	// Without JetStream there is nowhere to keep the counter
+	if _, err := NewKVSequencer(connectTestServer(t)).Next(context.Background(), "s1"); err == nil {
+		t.Error("Next() without JetStream should fail")
+	}
+}
+
+func TestSequencePublisher(t *testing.T) {
+	var published []Event
+	next := publisherFunc(func(_ context.Context, e Event) error {
+		published = append(published, e)
+		return nil
+	})
+	seqErr := errors.New("no counter")
+	failing := false
+	sequencer := NewLocalSequencer(t.TempDir())
+	var errs []error
+	p := NewSequencePublisher(next, sequencerFunc(func(ctx context.Context, session string) (uint64, error) {
+		if failing {
+			return 0, seqErr
+		}
+		return sequencer.Next(ctx, session)
+	}))
+	p.OnError = func(err error) { errs = append(errs, err) }
+
+	tests := []struct {
+		name    string
+		event   Event
+		failing bool
+		wantSeq uint64
+		wantErr bool
+	}{
+		{name: "first", event: Event{Type: "progress", Message: "m", SessionID: "s1"}, wantSeq: 1},
+		{name: "second", event: Event{Type: "progress", Message: "m", SessionID: "s1"}, wantSeq: 2},
+		{name: "no session", event: Event{Type: "progress", Message: "m"}, wantSeq: 0},
+		{name: "already numbered", event: Event{Type: "progress", Message: "m", SessionID: "s1", Seq: 9}, wantSeq: 9},
+		{name: "invalid event", event: Event{Type: "nope", Message: "m", SessionID: "s1"}, wantErr: true},
+		{name: "sequencer down", event: Event{Type: "progress", Message: "m", SessionID: "s1"}, failing: true, wantSeq: 0},
+		{name: "after invalid", event: Event{Type: "progress", Message: "m", SessionID: "s1"}, wantSeq: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			published, errs, failing = nil, nil, tt.failing
+			err := p.Publish(context.Background(), tt.event)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidEvent) || len(published) != 0 {
+					t.Errorf("Publish() error = %v, published %d, want ErrInvalidEvent and nothing published", err, len(published))
+				}
+				return
+			}
+			if err != nil || len(published) != 1 {
+				t.Fatalf("Publish() error = %v, published %d", err, len(published))
+			}
+			if published[0].Seq != tt.wantSeq {
+				t.Errorf("Seq = %d, want %d", published[0].Seq, tt.wantSeq)
+			}
+			if tt.failing != (len(errs) == 1) {
+				t.Errorf("OnError calls = %v", errs)
+			}
+		})
+	}
+}
+
+type sequencerFunc func(context.Context, string) (uint64, error)
+
+func (f sequencerFunc) Next(ctx context.Context, sessionID string) (uint64, error) {
+	return f(ctx, sessionID)
+}
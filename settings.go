@@ -0,0 +1,504 @@
+package clog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrInvalidConfig marks a config file that exists but cannot be used
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// Setting sources, in precedence order
+const (
+	SourceFlag     = "flag"
+	SourceEnv      = "env"
+	SourceHelper   = "credential helper"
+	SourceContext  = "context"
+	SourceConfig   = "config"
+	SourceBaked    = "baked"
+	SourceDefault  = "default"
+	SourceSelected = "nats context select"
+	SourceProject  = "project"
+)
+
+// Environment variables for each connection setting
+var EnvNames = map[string]string{
+	"url":      "NATS_URL",
+	"creds":    "NATS_CREDS",
+	"username": "NATS_USERNAME",
+	"password": "NATS_PASSWORD",
+	"token":    "NATS_TOKEN",
+	"nkey":     "NATS_NKEY",
+	"jwt":      "NATS_JWT",
+	"seed":     "NATS_SEED",
+	"context":  "NATS_CONTEXT",
+
+	"credential_helper":     "CLOG_CREDENTIAL_HELPER",
+	"credential_helper_ttl": "CLOG_CREDENTIAL_HELPER_TTL",
+	"sinks":                 "CLOG_SINKS",
+	"sink_policy":           "CLOG_SINK_POLICY",
+	"audit_log":             "CLOG_AUDIT_LOG",
+	"audit_log_max_size":    "CLOG_AUDIT_LOG_MAX_SIZE",
+	"format":                "CLOG_FORMAT",
+	"cloudevents_source":    "CLOG_CLOUDEVENTS_SOURCE",
+	"otlp_endpoint":         "CLOG_OTLP_ENDPOINT",
+	"sequence":              "CLOG_SEQUENCE",
+	"dedupe":                "CLOG_DEDUPE",
+	"dedupe_window":         "CLOG_DEDUPE_WINDOW",
+	"rate_limit":            "CLOG_RATE_LIMIT",
+	"rate_limit_mode":       "CLOG_RATE_LIMIT_MODE",
+	"redact":                "CLOG_REDACT",
+	"redact_rules":          "CLOG_REDACT_RULES",
+	"privacy":               "CLOG_PRIVACY",
+	"privacy_salt":          "CLOG_PRIVACY_SALT",
+	"compression":           "CLOG_COMPRESSION",
+	"compression_threshold": "CLOG_COMPRESSION_THRESHOLD",
+}
+
+// Connection options beyond credentials, in display order
+var OptionFields = []string{"ca", "cert", "key", "tls_first", "inbox_prefix", "credential_helper", "credential_helper_ttl", "sinks", "sink_policy", "audit_log", "audit_log_max_size", "format", "cloudevents_source", "otlp_endpoint", "sequence", "dedupe", "dedupe_window", "rate_limit", "rate_limit_mode", "redact", "redact_rules", "privacy", "privacy_salt", "compression", "compression_threshold"}
+
+// Credential fields used by each auth type, in display order
+var AuthFields = map[string][]string{
+	"none":          {},
+	"creds":         {"creds"},
+	"userpass":      {"username", "password"},
+	"token":         {"token"},
+	"nkey":          {"nkey"},
+	"decentralized": {"jwt", "seed"},
+}
+
+// Fields whose values must never be printed
+var secretFields = map[string]bool{
+	"password": true,
+	"token":    true,
+	"nkey":     true,
+	"jwt":      true,
+	"seed":     true,
+
+	"privacy_salt": true,
+}
+
+// configFile is the optional JSON config file (CLOG_CONFIG, or
+// <user config dir>/clog/config.json)
+type configFile struct {
+	URL      string `json:"url,omitempty"`
+	Creds    string `json:"creds,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	NKey     string `json:"nkey,omitempty"`
+	JWT      string `json:"jwt,omitempty"`
+	Seed     string `json:"seed,omitempty"`
+
+	CredentialHelper    string `json:"credential_helper,omitempty"`
+	CredentialHelperTTL string `json:"credential_helper_ttl,omitempty"`
+
+	Sinks      string `json:"sinks,omitempty"`
+	SinkPolicy string `json:"sink_policy,omitempty"`
+
+	AuditLog        string `json:"audit_log,omitempty"`
+	AuditLogMaxSize string `json:"audit_log_max_size,omitempty"`
+
+	Format            string `json:"format,omitempty"`
+	CloudEventsSource string `json:"cloudevents_source,omitempty"`
+
+	OTLPEndpoint string `json:"otlp_endpoint,omitempty"`
+
+	Sequence     string `json:"sequence,omitempty"`
+	Dedupe       string `json:"dedupe,omitempty"`
+	DedupeWindow string `json:"dedupe_window,omitempty"`
+
+	RateLimit     string `json:"rate_limit,omitempty"`
+	RateLimitMode string `json:"rate_limit_mode,omitempty"`
+
+	Redact      string `json:"redact,omitempty"`
+	RedactRules string `json:"redact_rules,omitempty"`
+
+	Privacy     string `json:"privacy,omitempty"`
+	PrivacySalt string `json:"privacy_salt,omitempty"`
+
+	Compression          string `json:"compression,omitempty"`
+	CompressionThreshold string `json:"compression_threshold,omitempty"`
+}
+
+// settingsLayer is one source of settings, keyed by field name
+type settingsLayer struct {
+	source string
+	values map[string]string
+}
+
+// Setting is a resolved configuration value tagged with where it came from
+type Setting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Env    string `json:"env,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+	Sealed bool   `json:"sealed,omitempty"`
+	field  string
+}
+
+// Settings is the effective connection configuration
+type Settings struct {
+	ConfigPath  string             `json:"config_path"`
+	ConfigFound bool               `json:"config_found"`
+	Context     Setting            `json:"context"`
+	ContextPath string             `json:"context_path,omitempty"`
+	ProjectPath string             `json:"project_path,omitempty"`
+	URL         Setting            `json:"url"`
+	AuthType    Setting            `json:"auth_type"`
+	Auth        map[string]Setting `json:"auth"`
+	Options     map[string]Setting `json:"options,omitempty"`
+
+	baked Baked
+}
+
+// Baked is the configuration compiled into a binary, the lowest-precedence
+// source of settings
+type Baked struct {
+	URL      string
+	AuthType string // none, userpass, token, nkey, decentralized
+	Username string
+	Password string
+	Token    string
+	NKey     string
+	JWT      string
+	Seed     string
+
+	// Sealed replaces the secret fields with the output of SealSecrets; it is
+	// only decrypted (with the key from KeySource) when connecting
+	Sealed    string
+	KeySource string
+}
+
+// configPath returns the config file location
+func configPath() string {
+	if path := os.Getenv("CLOG_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "clog", "config.json")
+}
+
+// loadConfig reads the config file; a missing file is not an error
+func loadConfig(path string) (configFile, bool, error) {
+	var cfg configFile
+	if path == "" {
+		return cfg, false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, false, nil
+	}
+	if err != nil {
+		return cfg, false, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, true, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	return cfg, true, nil
+}
+
+// values returns the config file settings keyed by field name
+func (c configFile) values() map[string]string {
+	return map[string]string{
+		"url":      c.URL,
+		"creds":    c.Creds,
+		"username": c.Username,
+		"password": c.Password,
+		"token":    c.Token,
+		"nkey":     c.NKey,
+		"jwt":      c.JWT,
+		"seed":     c.Seed,
+
+		"credential_helper":     c.CredentialHelper,
+		"credential_helper_ttl": c.CredentialHelperTTL,
+		"sinks":                 c.Sinks,
+		"sink_policy":           c.SinkPolicy,
+		"audit_log":             c.AuditLog,
+		"audit_log_max_size":    c.AuditLogMaxSize,
+		"format":                c.Format,
+		"cloudevents_source":    c.CloudEventsSource,
+		"otlp_endpoint":         c.OTLPEndpoint,
+		"sequence":              c.Sequence,
+		"dedupe":                c.Dedupe,
+		"dedupe_window":         c.DedupeWindow,
+		"rate_limit":            c.RateLimit,
+		"rate_limit_mode":       c.RateLimitMode,
+		"redact":                c.Redact,
+		"redact_rules":          c.RedactRules,
+		"privacy":               c.Privacy,
+		"privacy_salt":          c.PrivacySalt,
+		"compression":           c.Compression,
+		"compression_threshold": c.CompressionThreshold,
+	}
+}
+
+// envValues returns the environment settings keyed by field name
+func envValues() map[string]string {
+	values := make(map[string]string, len(EnvNames))
+	for field, name := range EnvNames {
+		values[field] = os.Getenv(name)
+	}
+	return values
+}
+
+// values returns the build-time settings keyed by field name
+func (b Baked) values() map[string]string {
+	return map[string]string{
+		"url":      b.URL,
+		"username": b.Username,
+		"password": b.Password,
+		"token":    b.Token,
+		"nkey":     b.NKey,
+		"jwt":      b.JWT,
+		"seed":     b.Seed,
+	}
+}
+
+// Validate checks baked credentials the same way Connect will check them at
+// runtime, so broken credentials fail the build
+func (b Baked) Validate() error {
+	if b.URL == "" {
+		return errors.New("url is required")
+	}
+
+	s := Settings{
+		URL:      newSetting("url", b.URL, SourceBaked),
+		AuthType: Setting{Value: b.AuthType, Source: SourceBaked},
+		Auth:     make(map[string]Setting),
+		baked:    b,
+	}
+	values := b.values()
+	for _, field := range AuthFields[b.AuthType] {
+		s.Auth[field] = newSetting(field, values[field], SourceBaked)
+	}
+
+	_, err := authOptions(s)
+	return err
+}
+
+// pickAuth returns the auth type implied by a set of values, or "" if none
+func pickAuth(values map[string]string) string {
+	switch {
+	case values["creds"] != "":
+		return "creds"
+	case values["username"] != "" || values["password"] != "":
+		return "userpass"
+	case values["token"] != "":
+		return "token"
+	case values["nkey"] != "":
+		return "nkey"
+	case values["jwt"] != "" || values["seed"] != "":
+		return "decentralized"
+	}
+	return ""
+}
+
+// ResolveSettings works out the effective URL, credentials and options.
+// Priority order for all of them:
+// 1. Environment variables
+// 2. NATS CLI context (-context flag, NATS_CONTEXT, or 'nats context select')
+// 3. Config file
+// 4. Baked-in configuration (based on baked.AuthType)
+// A credential helper's output ranks just above the source that configured it.
+// Credentials are never mixed across sources: the first source that sets any
+// credential supplies all of them.
+func ResolveSettings(contextName string, baked Baked) (Settings, error) {
+	s := Settings{ConfigPath: configPath(), baked: baked}
+
+	cfg, found, err := loadConfig(s.ConfigPath)
+	if err != nil {
+		return s, err
+	}
+	s.ConfigFound = found
+
+	switch {
+	case contextName != "":
+		s.Context = newSetting("context", contextName, SourceFlag)
+	case os.Getenv("NATS_CONTEXT") != "":
+		s.Context = newSetting("context", os.Getenv("NATS_CONTEXT"), SourceEnv)
+	case selectedContext() != "":
+		s.Context = newSetting("context", selectedContext(), SourceSelected)
+	}
+
+	layers := []settingsLayer{{SourceEnv, envValues()}}
+	if s.Context.Value != "" {
+		ctx, path, err := loadContext(s.Context.Value)
+		if err != nil {
+			return s, err
+		}
+		s.ContextPath = path
+		layers = append(layers, settingsLayer{SourceContext, ctx.values()})
+	}
+	layers = append(layers,
+		settingsLayer{SourceConfig, cfg.values()},
+		settingsLayer{SourceBaked, baked.values()},
+	)
+
+	layers, err = withCredentialHelper(layers)
+	if err != nil {
+		return s, err
+	}
+
+	for _, layer := range layers {
+		if url := layer.values["url"]; url != "" {
+			s.URL = newSetting("url", url, layer.source)
+			break
+		}
+	}
+	if s.URL.Value == "" {
+		s.URL = newSetting("url", nats.DefaultURL, SourceDefault)
+	}
+
+	for _, layer := range layers {
+		authType := pickAuth(layer.values)
+		if layer.source == SourceBaked {
+			authType = baked.AuthType
+			if authType == "" {
+				authType = "none"
+			}
+		}
+		if authType == "" {
+			continue
+		}
+
+		s.AuthType = Setting{Value: authType, Source: layer.source}
+		s.Auth = make(map[string]Setting)
+		for _, field := range AuthFields[authType] {
+			value := newSetting(field, layer.values[field], layer.source)
+			value.Sealed = layer.source == SourceBaked && baked.Sealed != "" && value.Secret
+			s.Auth[field] = value
+		}
+		break
+	}
+
+	s.Options = make(map[string]Setting)
+	for _, field := range OptionFields {
+		for _, layer := range layers {
+			if value := layer.values[field]; value != "" {
+				s.Options[field] = newSetting(field, value, layer.source)
+				break
+			}
+		}
+	}
+
+	// A project file can only make events more private
+	if err := applyProjectPrivacy(&s); err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// newSetting tags a value with its source and secrecy
+func newSetting(field, value, source string) Setting {
+	s := Setting{Value: value, Source: source, Secret: secretFields[field], field: field}
+	if source == SourceEnv {
+		s.Env = EnvNames[field]
+	}
+	return s
+}
+
+// display returns the value safe for printing, with secrets redacted
+func (s Setting) display() string {
+	switch {
+	case s.Sealed && s.Value == "":
+		return "[encrypted]"
+	case s.Secret:
+		return redact(s.Value)
+	case s.field == "url" || s.field == "sinks" || s.field == "otlp_endpoint":
+		return redactURL(s.Value)
+	case s.field == "credential_helper":
+		return redactCommand(s.Value)
+	}
+	return s.Value
+}
+
+// MarshalJSON encodes the setting with secrets redacted
+func (s Setting) MarshalJSON() ([]byte, error) {
+	type plain Setting
+	p := plain(s)
+	p.Value = s.display()
+	return json.Marshal(p)
+}
+
+// String renders the setting for humans, with secrets redacted
+func (s Setting) String() string {
+	value := s.display()
+	if value == "" {
+		value = "(empty)"
+	}
+
+	source := s.Source
+	if s.Env != "" {
+		source += " " + s.Env
+	}
+	return fmt.Sprintf("%s (%s)", value, source)
+}
+
+// redact hides a secret value while keeping its length visible
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf("[redacted, %d chars]", len(value))
+}
+
+// redactURL hides any user info (user/password or token) and query values
+// in a server list; webhooks often carry their token in the query
+func redactURL(servers string) string {
+	parts := strings.Split(servers, ",")
+	for i, server := range parts {
+		u, err := url.Parse(strings.TrimSpace(server))
+		if err != nil || (u.User == nil && u.RawQuery == "") {
+			continue
+		}
+		if u.User != nil {
+			u.User = url.User("redacted")
+		}
+		if u.RawQuery != "" {
+			query := u.Query()
+			for name := range query {
+				query[name] = []string{"redacted"}
+			}
+			u.RawQuery = query.Encode()
+		}
+		parts[i] = u.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// redactURLError hides secrets in the URL of an HTTP client error, which
+// otherwise prints it in full
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		redacted := *urlErr
+		redacted.URL = redactURL(urlErr.URL)
+		return &redacted
+	}
+	return err
+}
+
+// redactCommand keeps a command's program name and hides its arguments,
+// which may include tokens or vault paths
+func redactCommand(command string) string {
+	program, args, ok := strings.Cut(strings.TrimSpace(command), " ")
+	if !ok {
+		return program
+	}
+	return program + " " + redact(strings.TrimSpace(args))
+}
@@ -0,0 +1,317 @@
+package clog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink kinds accepted in the sinks setting
+const (
+	SinkNATS   = "nats"
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkHTTP   = "http"
+)
+
+// Sink failure policies
+const (
+	// SinkPolicyAll fails the publish if any sink fails
+	SinkPolicyAll = "all"
+	// SinkPolicyAny succeeds if at least one sink accepts the event
+	SinkPolicyAny = "any"
+)
+
+// Defaults when the sinks and sink_policy settings are unset
+const (
+	defaultSinks      = SinkNATS
+	defaultSinkPolicy = SinkPolicyAll
+)
+
+// SinkSpec is one entry of the sinks setting
+type SinkSpec struct {
+	Kind   string // nats|stdout|file|http
+	Target string // file path or HTTP URL
+}
+
+// String renders the spec the way it is written in the sinks setting
+func (s SinkSpec) String() string {
+	switch s.Kind {
+	case SinkFile:
+		return SinkFile + ":" + s.Target
+	case SinkHTTP:
+		return redactURL(s.Target)
+	}
+	return s.Kind
+}
+
+// ParseSinks parses a comma-separated sinks setting such as
+// "nats,file:/var/log/clog.jsonl,https://hooks.example.com/clog"
+func ParseSinks(spec string) ([]SinkSpec, error) {
+	var sinks []SinkSpec
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			continue
+		case entry == SinkNATS || entry == SinkStdout:
+			sinks = append(sinks, SinkSpec{Kind: entry})
+		case strings.HasPrefix(entry, SinkFile+":"):
+			path := strings.TrimPrefix(entry, SinkFile+":")
+			if path == "" {
+				return nil, fmt.Errorf("%w: sink 'file:' needs a path", ErrInvalidConfig)
+			}
+			sinks = append(sinks, SinkSpec{Kind: SinkFile, Target: path})
+		case strings.HasPrefix(entry, "http://") || strings.HasPrefix(entry, "https://"):
+			sinks = append(sinks, SinkSpec{Kind: SinkHTTP, Target: entry})
+		default:
+			return nil, fmt.Errorf("%w: unknown sink '%s'. Must be: nats|stdout|file:<path>|http(s)://<url>", ErrInvalidConfig, redactURL(entry))
+		}
+	}
+
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("%w: no sinks configured", ErrInvalidConfig)
+	}
+	return sinks, nil
+}
+
+// SinkOptions returns the configured sinks and failure policy, defaulting to
+// NATS only with the "all" policy
+func SinkOptions(s Settings) ([]SinkSpec, string, error) {
+	spec := s.Options["sinks"].Value
+	if spec == "" {
+		spec = defaultSinks
+	}
+	sinks, err := ParseSinks(spec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	policy := s.Options["sink_policy"].Value
+	switch policy {
+	case "":
+		policy = defaultSinkPolicy
+	case SinkPolicyAll, SinkPolicyAny:
+	default:
+		return nil, "", fmt.Errorf("%w: invalid sink_policy '%s'. Must be: all|any", ErrInvalidConfig, policy)
+	}
+	return sinks, policy, nil
+}
+
+// SinkError records which sink failed to accept an event
+type SinkError struct {
+	Sink string
+	Err  error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("sink %s: %v", e.Sink, e.Err)
+}
+
+func (e *SinkError) Unwrap() error {
+	return e.Err
+}
+
+// Sink is a named destination for events
+type Sink struct {
+	Name      string
+	Publisher Publisher
+}
+
+// MultiPublisher sends each event to several sinks
+type MultiPublisher struct {
+	sinks  []Sink
+	policy string
+
+	// OnError, if set, is called for each sink that fails. With the "any"
+	// policy it is the only place partial failures are reported.
+	OnError func(err *SinkError)
+}
+
+// NewMultiPublisher sends events to every sink, applying policy (SinkPolicyAll
+// or SinkPolicyAny) when some of them fail
+func NewMultiPublisher(policy string, sinks ...Sink) *MultiPublisher {
+	return &MultiPublisher{sinks: sinks, policy: policy}
+}
+
+// Publish validates the event and sends it to every sink, even after one
+// fails, so each destination gets the event when it can
+func (m *MultiPublisher) Publish(ctx context.Context, e Event) error {
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	// Every sink records the same ID and timestamp
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	var errs []error
+	for _, sink := range m.sinks {
+		if err := sink.Publisher.Publish(ctx, e); err != nil {
+			sinkErr := &SinkError{Sink: sink.Name, Err: err}
+			if m.OnError != nil {
+				m.OnError(sinkErr)
+			}
+			errs = append(errs, sinkErr)
+		}
+	}
+
+	if m.policy == SinkPolicyAny && len(errs) < len(m.sinks) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// WriterPublisher writes events as JSON lines, e.g. to stdout
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	// Format selects the encoding; binary CloudEvents are written structured
+	Format Format
+}
+
+// NewWriterPublisher writes one JSON line per event to w
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+// Publish writes the event as a JSON line
+func (p *WriterPublisher) Publish(ctx context.Context, e Event) error {
+	line, err := jsonLine(e, p.Format)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(line)
+	return err
+}
+
+// FilePublisher appends events to a JSONL file
+type FilePublisher struct {
+	path string
+
+	// Format selects the encoding; binary CloudEvents are written structured
+	Format Format
+}
+
+// NewFilePublisher appends to path, creating it (mode 0600) and its directory
+// on first use
+func NewFilePublisher(path string) *FilePublisher {
+	return &FilePublisher{path: path}
+}
+
+// Publish appends the event as one line, in a single write so concurrent
+// clog processes do not interleave
+func (p *FilePublisher) Publish(ctx context.Context, e Event) error {
+	line, err := jsonLine(e, p.Format)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// HTTPPublisher POSTs events as JSON to a URL
+type HTTPPublisher struct {
+	url    string
+	client *http.Client
+
+	// Format selects the encoding; binary CloudEvents attributes are sent as
+	// ce- headers
+	Format Format
+
+	// Compression compresses big request bodies, noted in a Content-Encoding
+	// header
+	Compression Compression
+}
+
+// NewHTTPPublisher posts to url with client, or http.DefaultClient if nil
+func NewHTTPPublisher(url string, client *http.Client) *HTTPPublisher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPPublisher{url: url, client: client}
+}
+
+// Publish POSTs the event and expects a 2xx response. The event ID is sent as
+// Idempotency-Key so receivers can drop retries.
+func (p *HTTPPublisher) Publish(ctx context.Context, e Event) error {
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+	data, headers, err := p.Format.encode(e)
+	if err != nil {
+		return err
+	}
+	if data, headers, err = p.Compression.apply(data, headers); err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("Idempotency-Key", e.ID)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return redactURLError(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s returned %s", redactURL(p.url), resp.Status)
+	}
+	return nil
+}
+
+// jsonLine validates the event and encodes it as a newline-terminated JSON
+// document
+func jsonLine(e Event, f Format) ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	data, _, err := f.structured().encode(e)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,268 @@
+package clog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []SinkSpec
+		wantErr bool
+	}{
+		{
+			name: "nats only",
+			spec: "nats",
+			want: []SinkSpec{{Kind: SinkNATS}},
+		},
+		{
+			name: "combined with spaces",
+			spec: "nats, stdout ,file:/tmp/clog.jsonl,https://hooks.example.com/clog",
+			want: []SinkSpec{
+				{Kind: SinkNATS},
+				{Kind: SinkStdout},
+				{Kind: SinkFile, Target: "/tmp/clog.jsonl"},
+				{Kind: SinkHTTP, Target: "https://hooks.example.com/clog"},
+			},
+		},
+		{name: "file without path", spec: "file:", wantErr: true},
+		{name: "unknown sink", spec: "kafka", wantErr: true},
+		{name: "empty", spec: " , ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSinks(tt.spec)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("ParseSinks() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSinks() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseSinks() = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("ParseSinks()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSinkOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantSinks  int
+		wantPolicy string
+		wantErr    bool
+	}{
+		{name: "defaults", wantSinks: 1, wantPolicy: SinkPolicyAll},
+		{name: "any policy", env: map[string]string{"CLOG_SINKS": "stdout,file:/tmp/x", "CLOG_SINK_POLICY": "any"}, wantSinks: 2, wantPolicy: SinkPolicyAny},
+		{name: "bad policy", env: map[string]string{"CLOG_SINK_POLICY": "some"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateSettings(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			s, err := ResolveSettings("", Baked{})
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+
+			sinks, policy, err := SinkOptions(s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("SinkOptions() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SinkOptions() error = %v", err)
+			}
+			if len(sinks) != tt.wantSinks || policy != tt.wantPolicy {
+				t.Errorf("SinkOptions() = %v, %q, want %d sinks, %q", sinks, policy, tt.wantSinks, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+// publisherFunc adapts a function to the Publisher interface
+type publisherFunc func(context.Context, Event) error
+
+func (f publisherFunc) Publish(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+func TestMultiPublisherPolicy(t *testing.T) {
+	errDown := errors.New("sink down")
+	ok := publisherFunc(func(context.Context, Event) error { return nil })
+	failing := publisherFunc(func(context.Context, Event) error { return errDown })
+
+	tests := []struct {
+		name       string
+		policy     string
+		sinks      []Sink
+		wantErr    bool
+		wantFailed int
+	}{
+		{name: "all succeed", policy: SinkPolicyAll, sinks: []Sink{{"a", ok}, {"b", ok}}},
+		{name: "all with one failure", policy: SinkPolicyAll, sinks: []Sink{{"a", ok}, {"b", failing}}, wantErr: true, wantFailed: 1},
+		{name: "any with one failure", policy: SinkPolicyAny, sinks: []Sink{{"a", failing}, {"b", ok}}, wantFailed: 1},
+		{name: "any with every failure", policy: SinkPolicyAny, sinks: []Sink{{"a", failing}, {"b", failing}}, wantErr: true, wantFailed: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failed []string
+			m := NewMultiPublisher(tt.policy, tt.sinks...)
+			m.OnError = func(err *SinkError) { failed = append(failed, err.Sink) }
+
+			err := m.Publish(context.Background(), Event{Type: "progress", Message: "m"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errDown) {
+				t.Errorf("Publish() error = %v, want it to wrap the sink error", err)
+			}
+			if len(failed) != tt.wantFailed {
+				t.Errorf("OnError called for %v, want %d sinks", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestMultiPublisherSameTimestamp(t *testing.T) {
+	var stamps []time.Time
+	record := publisherFunc(func(_ context.Context, e Event) error {
+		stamps = append(stamps, e.Timestamp)
+		return nil
+	})
+
+	m := NewMultiPublisher(SinkPolicyAll, Sink{"a", record}, Sink{"b", record})
+	if err := m.Publish(context.Background(), Event{Type: "progress", Message: "m"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if len(stamps) != 2 || stamps[0].IsZero() || !stamps[0].Equal(stamps[1]) {
+		t.Errorf("timestamps = %v, want one shared non-zero time", stamps)
+	}
+
+	if err := m.Publish(context.Background(), Event{Type: "note", Message: "m"}); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Publish() invalid event error = %v, want ErrInvalidEvent", err)
+	}
+}
+
+func TestWriterPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewWriterPublisher(&buf)
+	for _, message := range []string{"one", "two"} {
+		if err := p.Publish(context.Background(), Event{Type: "progress", Message: message}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	lines := readLines(t, &buf)
+	if len(lines) != 2 || lines[1].Message != "two" || lines[1].Event != "claude.progress.update" {
+		t.Errorf("lines = %+v", lines)
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "clog.jsonl")
+	p := NewFilePublisher(path)
+	for _, message := range []string{"one", "two"} {
+		if err := p.Publish(context.Background(), Event{Type: "task", State: "completed", Message: message}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("os.Stat() error = %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("os.Open() error = %v", err)
+	}
+	defer f.Close()
+	lines := readLines(t, f)
+	if len(lines) != 2 || lines[0].Message != "one" || lines[0].Event != "claude.tasks.completed" {
+		t.Errorf("lines = %+v", lines)
+	}
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	var got Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	event := Event{Type: "question", State: "blocked", Message: "Inclusive?", SessionID: "s1"}
+	if err := NewHTTPPublisher(srv.URL+"/ok", nil).Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if got.Event != "claude.questions.waiting" || got.SessionID != "s1" {
+		t.Errorf("posted = %+v", got)
+	}
+
+	if err := NewHTTPPublisher(srv.URL+"/fail?token=supersecret", nil).Publish(context.Background(), event); err == nil || strings.Contains(err.Error(), "supersecret") {
+		t.Errorf("Publish() to a failing endpoint error = %v, want an error without the token", err)
+	}
+	srv.Close()
+	if err := NewHTTPPublisher(srv.URL+"/ok?token=supersecret", nil).Publish(context.Background(), event); err == nil || strings.Contains(err.Error(), "supersecret") {
+		t.Errorf("Publish() to a closed endpoint error = %v, want an error without the token", err)
+	}
+}
+
+// readLines decodes JSON lines written by a sink
+func readLines(t *testing.T, r io.Reader) []Message {
+	t.Helper()
+	var lines []Message
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var m Message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatalf("json.Unmarshal(%q) error = %v", scanner.Text(), err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
@@ -0,0 +1,444 @@
+package clog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP span kinds and status codes used by the trace exporter
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusUnset      = 0
+	otlpStatusOK         = 1
+)
+
+// TraceOptions returns the OTLP/HTTP traces URL configured by otlp_endpoint,
+// or "" when tracing is off. A base URL such as http://localhost:4318 gets
+// the standard /v1/traces path.
+func TraceOptions(s Settings) (string, error) {
+	endpoint := s.Options["otlp_endpoint"].Value
+	if endpoint == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%w: otlp_endpoint '%s' must be an http(s) URL", ErrInvalidConfig, redactURL(endpoint))
+	}
+	if !strings.HasSuffix(u.Path, "/v1/traces") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// TraceID returns the trace ID for a session, so every clog invocation for
+// the session joins the same trace
+func TraceID(sessionID string) string {
+	sum := sha256.Sum256([]byte("clog trace\x00" + sessionID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// SessionSpanID returns the ID of a session's root span
+func SessionSpanID(sessionID string) string {
+	sum := sha256.Sum256([]byte("clog session\x00" + sessionID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// TaskSpanID returns the ID of a task's span. taskKey is the task number
+// (-task-num) or, for tasks without one, "#<n>" for the nth task started in
+// the session. A task that ends more than once, such as blocked and then
+// completed, gets "@<n>" appended for its nth span.
+func TaskSpanID(sessionID, taskKey string) string {
+	sum := sha256.Sum256([]byte("clog task\x00" + sessionID + "\x00" + taskKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// traceState is what clog remembers about a session between invocations:
+// spans that have started but not yet ended
+type traceState struct {
+	SessionStart time.Time            `json:"session_start,omitempty"`
+	SessionName  string               `json:"session_name,omitempty"`
+	Events       []spanEvent          `json:"events,omitempty"`
+	Tasks        map[string]*openSpan `json:"tasks,omitempty"`
+	Current      string               `json:"current,omitempty"`
+	TaskCount    int                  `json:"task_count,omitempty"`
+	Ended        map[string]int       `json:"ended,omitempty"` // spans ended per task
+}
+
+// openSpan is a task span waiting for its end
+type openSpan struct {
+	Start      time.Time         `json:"start"`
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Events     []spanEvent       `json:"events,omitempty"`
+}
+
+// spanEvent is a question or progress update inside a span
+type spanEvent struct {
+	Time       time.Time         `json:"time"`
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// finishedSpan is a span ready to export
+type finishedSpan struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Start, End time.Time
+	Attributes map[string]string
+	Events     []spanEvent
+	Status     int
+}
+
+// TracePublisher maps sessions to traces and tasks to spans, exporting each
+// span over OTLP/HTTP when it ends. Session starts and task starts are kept
+// in the user cache directory until then, so separate clog invocations build
+// one trace.
+type TracePublisher struct {
+	next     Publisher
+	endpoint string
+	client   *http.Client
+
+	// OnError, if set, is called when a span cannot be recorded or exported.
+	// Tracing failures never fail the publish itself.
+	OnError func(err error)
+}
+
+// NewTracePublisher publishes through next and, for events with a session,
+// exports spans to the OTLP/HTTP traces endpoint
+func NewTracePublisher(next Publisher, endpoint string) *TracePublisher {
+	return &TracePublisher{next: next, endpoint: endpoint, client: http.DefaultClient}
+}
+
+// Publish publishes the event, then updates the session's trace
+func (p *TracePublisher) Publish(ctx context.Context, e Event) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	if err := p.next.Publish(ctx, e); err != nil {
+		return err
+	}
+	if e.SessionID == "" {
+		return nil
+	}
+
+	if err := p.trace(ctx, e); err != nil && p.OnError != nil {
+		p.OnError(err)
+	}
+	return nil
+}
+
+// trace records the event in the session's trace state and exports any span
+// it ends
+func (p *TracePublisher) trace(ctx context.Context, e Event) error {
+	path := traceStatePath(e.SessionID)
+	if path == "" {
+		return errors.New("no cache directory for trace state")
+	}
+	spans, err := updateTraceState(ctx, path, e)
+	if err != nil {
+		return fmt.Errorf("saving trace state: %w", err)
+	}
+
+	if len(spans) == 0 {
+		return nil
+	}
+	return p.export(ctx, spans)
+}
+
+// apply updates the state for an event and returns the spans it ends
+func (s *traceState) apply(e Event) []finishedSpan {
+	at := e.Timestamp
+	traceID, sessionSpan := TraceID(e.SessionID), SessionSpanID(e.SessionID)
+	if s.Tasks == nil {
+		s.Tasks = map[string]*openSpan{}
+	}
+
+	switch e.Type {
+	case "session":
+		if e.State != "completed" {
+			s.SessionStart, s.SessionName = at, e.Message
+			return nil
+		}
+		start := s.SessionStart
+		if start.IsZero() {
+			start = at
+		}
+		name := s.SessionName
+		if name == "" {
+			name = "session " + e.SessionID
+		}
+		span := finishedSpan{
+			TraceID: traceID, SpanID: sessionSpan, Name: name, Start: start, End: at,
+			Attributes: map[string]string{"clog.session_id": e.SessionID, "clog.message": e.Message},
+			Events:     s.Events,
+			Status:     otlpStatusOK,
+		}
+		*s = traceState{}
+		return []finishedSpan{span}
+
+	case "task":
+		switch e.State {
+		case "in_progress":
+			key := e.TaskNum
+			if key == "" {
+				key = "#" + strconv.Itoa(s.TaskCount+1)
+			}
+			s.TaskCount++
+			attrs := map[string]string{"clog.session_id": e.SessionID}
+			if e.TaskNum != "" {
+				attrs["clog.task_num"] = e.TaskNum
+			}
+			if e.UserPrompt != "" {
+				attrs["clog.user_prompt"] = e.UserPrompt
+			}
+			s.Tasks[key] = &openSpan{Start: at, Name: e.Message, Attributes: attrs}
+			s.Current = key
+			return nil
+
+		case "completed", "blocked":
+			key := e.TaskNum
+			if key == "" {
+				key = s.Current
+			}
+			open, ok := s.Tasks[key]
+			if !ok {
+				// The start was never seen; export a zero-length span
+				if key == "" {
+					key = "#" + strconv.Itoa(s.TaskCount+1)
+					s.TaskCount++
+				}
+				open = &openSpan{Start: at, Name: e.Message, Attributes: map[string]string{"clog.session_id": e.SessionID}}
+			}
+			delete(s.Tasks, key)
+			if s.Current == key {
+				s.Current = ""
+			}
+			// A resumed task ends again; each of its spans needs its own ID
+			if s.Ended == nil {
+				s.Ended = map[string]int{}
+			}
+			s.Ended[key]++
+			spanKey := key
+			if n := s.Ended[key]; n > 1 {
+				spanKey += "@" + strconv.Itoa(n)
+			}
+
+			attrs := open.Attributes
+			attrs["clog.state"] = e.State
+			attrs["clog.message"] = e.Message
+			status := otlpStatusOK
+			if e.State == "blocked" {
+				status = otlpStatusUnset
+			}
+			return []finishedSpan{{
+				TraceID: traceID, SpanID: TaskSpanID(e.SessionID, spanKey), ParentID: sessionSpan,
+				Name: open.Name, Start: open.Start, End: at,
+				Attributes: attrs, Events: open.Events, Status: status,
+			}}
+		}
+	}
+
+	// Questions, progress and other task states become events on the
+	// current task, or on the session when no task is open
+	event := spanEvent{Time: at, Name: e.Subject(), Attributes: map[string]string{"clog.message": e.Message}}
+	if e.State != "" {
+		event.Attributes["clog.state"] = e.State
+	}
+	if open, ok := s.Tasks[s.Current]; ok {
+		open.Events = append(open.Events, event)
+	} else {
+		s.Events = append(s.Events, event)
+	}
+	return nil
+}
+
+// done reports whether nothing is left to remember for the session. Ended
+// counts are kept until the session ends, so a task resumed later still gets
+// a new span ID.
+func (s *traceState) done() bool {
+	return s.SessionStart.IsZero() && len(s.Tasks) == 0 && len(s.Events) == 0 && len(s.Ended) == 0
+}
+
+// traceStatePath returns the trace state file for a session
+func traceStatePath(sessionID string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "clog", "traces", sessionKey(sessionID)+".json")
+}
+
+// updateTraceState applies the event to the session's trace state under its
+// lock, so sub-agents sharing a session never overwrite each other's starts,
+// and returns the spans it ends
+func updateTraceState(ctx context.Context, path string, e Event) ([]finishedSpan, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(ctx, path+".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	state, err := loadTraceState(path)
+	if err != nil {
+		return nil, err
+	}
+	spans := state.apply(e)
+	if state.done() {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return spans, nil
+	}
+	return spans, saveTraceState(path, state)
+}
+
+// loadTraceState reads a session's trace state; a missing file is empty state
+func loadTraceState(path string) (*traceState, error) {
+	state := &traceState{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		// A corrupt state file only loses span start times; start afresh
+		return &traceState{}, nil
+	}
+	return state, nil
+}
+
+// saveTraceState writes a session's trace state (mode 0600) to a temporary
+// file and renames it into place, so a reader never sees a torn write
+func saveTraceState(path string, state *traceState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// export sends spans to the collector as OTLP/HTTP JSON
+func (p *TracePublisher) export(ctx context.Context, spans []finishedSpan) error {
+	data, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("exporting spans: %w", redactURLError(err))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("exporting spans: POST %s returned %s", redactURL(p.endpoint), resp.Status)
+	}
+	return nil
+}
+
+// otlpRequest builds an ExportTraceServiceRequest in the OTLP JSON encoding
+func otlpRequest(spans []finishedSpan) map[string]any {
+	host, _ := os.Hostname()
+	resource := map[string]string{"service.name": "clog"}
+	if host != "" {
+		resource["host.name"] = host
+	}
+
+	otlpSpans := make([]map[string]any, 0, len(spans))
+	for _, span := range spans {
+		s := map[string]any{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              otlpSpanKindInternal,
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+			"status":            map[string]any{"code": span.Status},
+		}
+		if span.ParentID != "" {
+			s["parentSpanId"] = span.ParentID
+		}
+		if len(span.Events) > 0 {
+			events := make([]map[string]any, 0, len(span.Events))
+			for _, event := range span.Events {
+				events = append(events, map[string]any{
+					"timeUnixNano": strconv.FormatInt(event.Time.UnixNano(), 10),
+					"name":         event.Name,
+					"attributes":   otlpAttributes(event.Attributes),
+				})
+			}
+			s["events"] = events
+		}
+		otlpSpans = append(otlpSpans, s)
+	}
+
+	return map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{"attributes": otlpAttributes(resource)},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]any{"name": "clog"},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes encodes string attributes as OTLP KeyValues sorted by key,
+// skipping empty values
+func otlpAttributes(attrs map[string]string) []map[string]any {
+	keys := make([]string, 0, len(attrs))
+	for key, value := range attrs {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	keyValues := make([]map[string]any, 0, len(keys))
+	for _, key := range keys {
+		keyValues = append(keyValues, map[string]any{
+			"key":   key,
+			"value": map[string]string{"stringValue": attrs[key]},
+		})
+	}
+	return keyValues
+}
@@ -0,0 +1,287 @@
+package clog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceOptions(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{endpoint: "", want: ""},
+		{endpoint: "http://localhost:4318", want: "http://localhost:4318/v1/traces"},
+		{endpoint: "http://localhost:4318/", want: "http://localhost:4318/v1/traces"},
+		{endpoint: "https://otel.example.com/v1/traces", want: "https://otel.example.com/v1/traces"},
+		{endpoint: "localhost:4318", wantErr: true},
+		{endpoint: "grpc://localhost:4317", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			isolateSettings(t)
+			t.Setenv("CLOG_OTLP_ENDPOINT", tt.endpoint)
+			s, err := ResolveSettings("", Baked{})
+			if err != nil {
+				t.Fatalf("ResolveSettings() error = %v", err)
+			}
+
+			got, err := TraceOptions(s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("TraceOptions() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("TraceOptions() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceIDs(t *testing.T) {
+	if TraceID("s1") != TraceID("s1") || TraceID("s1") == TraceID("s2") {
+		t.Error("TraceID() should be deterministic and differ between sessions")
+	}
+	if len(TraceID("s1")) != 32 || len(SessionSpanID("s1")) != 16 || len(TaskSpanID("s1", "1")) != 16 {
+		t.Errorf("IDs have wrong lengths: %s %s %s", TraceID("s1"), SessionSpanID("s1"), TaskSpanID("s1", "1"))
+	}
+	if TaskSpanID("s1", "1") == TaskSpanID("s1", "2") || TaskSpanID("s1", "1") == SessionSpanID("s1") {
+		t.Error("span IDs should differ between tasks and the session")
+	}
+}
+
+// exportedSpan is the part of an OTLP JSON span the tests check
+type exportedSpan struct {
+	TraceID           string `json:"traceId"`
+	SpanID            string `json:"spanId"`
+	ParentSpanID      string `json:"parentSpanId"`
+	Name              string `json:"name"`
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string `json:"endTimeUnixNano"`
+	Events            []struct {
+		Name string `json:"name"`
+	} `json:"events"`
+	Status struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+// collector is a test OTLP/HTTP endpoint that records exported spans
+func collector(t *testing.T) (*httptest.Server, func() []exportedSpan) {
+	t.Helper()
+	var (
+		mu    sync.Mutex
+		spans []exportedSpan
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []exportedSpan {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]exportedSpan(nil), spans...)
+	}
+}
+
+func TestTracePublisher(t *testing.T) {
+	isolateSettings(t)
+	srv, spans := collector(t)
+	next := publisherFunc(func(context.Context, Event) error { return nil })
+
+	start := time.Date(2025, 10, 9, 14, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Type: "session", Message: "NYE API", SessionID: "nye"},
+		{Type: "task", State: "in_progress", Message: "Add VAT", TaskNum: "1", SessionID: "nye"},
+		{Type: "progress", Message: "tests passing", SessionID: "nye"},
+		{Type: "task", State: "completed", Message: "VAT added", TaskNum: "1", SessionID: "nye"},
+		{Type: "task", State: "in_progress", Message: "Deploy", SessionID: "nye"},
+		{Type: "task", State: "blocked", Message: "Needs approval", SessionID: "nye"},
+		{Type: "session", State: "completed", Message: "Done", SessionID: "nye"},
+	}
+	for i, e := range events {
+		e.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		// A new publisher per event, as with separate clog invocations
+		p := NewTracePublisher(next, srv.URL+"/v1/traces")
+		p.OnError = func(err error) { t.Errorf("trace error: %v", err) }
+		if err := p.Publish(context.Background(), e); err != nil {
+			t.Fatalf("Publish(%d) error = %v", i, err)
+		}
+	}
+
+	got := spans()
+	if len(got) != 3 {
+		t.Fatalf("exported %d spans, want 3: %+v", len(got), got)
+	}
+	nanos := func(minutes int) string {
+		return strconv.FormatInt(start.Add(time.Duration(minutes)*time.Minute).UnixNano(), 10)
+	}
+	tests := []struct {
+		span       exportedSpan
+		spanID     string
+		parentID   string
+		name       string
+		start, end int
+		status     int
+		events     int
+	}{
+		{span: got[0], spanID: TaskSpanID("nye", "1"), parentID: SessionSpanID("nye"), name: "Add VAT", start: 1, end: 3, status: otlpStatusOK, events: 1},
+		{span: got[1], spanID: TaskSpanID("nye", "#2"), parentID: SessionSpanID("nye"), name: "Deploy", start: 4, end: 5, status: otlpStatusUnset},
+		{span: got[2], spanID: SessionSpanID("nye"), name: "NYE API", start: 0, end: 6, status: otlpStatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.span
+			if s.TraceID != TraceID("nye") || s.SpanID != tt.spanID || s.ParentSpanID != tt.parentID {
+				t.Errorf("IDs = %s/%s/%s, want %s/%s/%s", s.TraceID, s.SpanID, s.ParentSpanID, TraceID("nye"), tt.spanID, tt.parentID)
+			}
+			if s.Name != tt.name || s.Status.Code != tt.status || len(s.Events) != tt.events {
+				t.Errorf("span = %+v", s)
+			}
+			if s.StartTimeUnixNano != nanos(tt.start) || s.EndTimeUnixNano != nanos(tt.end) {
+				t.Errorf("span times = %s-%s, want %s-%s", s.StartTimeUnixNano, s.EndTimeUnixNano, nanos(tt.start), nanos(tt.end))
+			}
+		})
+	}
+}
+
+func TestTracePublisherConcurrentTasks(t *testing.T) {
+	isolateSettings(t)
+	srv, spans := collector(t)
+	next := publisherFunc(func(context.Context, Event) error { return nil })
+	start := time.Date(2025, 10, 9, 14, 0, 0, 0, time.UTC)
+
+	// Sub-agents sharing a session start and finish their tasks at once
+	const agents = 10
+	for _, phase := range []struct {
+		state string
+		at    time.Time
+	}{{"in_progress", start}, {"completed", start.Add(time.Minute)}} {
+		var wg sync.WaitGroup
+		for i := 1; i <= agents; i++ {
+			wg.Add(1)
+			go func(task string) {
+				defer wg.Done()
+				p := NewTracePublisher(next, srv.URL+"/v1/traces")
+				p.OnError = func(err error) { t.Errorf("trace error: %v", err) }
+				e := Event{Type: "task", State: phase.state, Message: "task " + task, TaskNum: task, SessionID: "agents", Timestamp: phase.at}
+				if err := p.Publish(context.Background(), e); err != nil {
+					t.Errorf("Publish() error = %v", err)
+				}
+			}(strconv.Itoa(i))
+		}
+		wg.Wait()
+	}
+
+	got := spans()
+	if len(got) != agents {
+		t.Fatalf("exported %d spans, want %d", len(got), agents)
+	}
+	want := strconv.FormatInt(start.UnixNano(), 10)
+	for _, s := range got {
+		if s.StartTimeUnixNano != want {
+			t.Errorf("span %s starts at %s, want %s (task start lost)", s.Name, s.StartTimeUnixNano, want)
+		}
+	}
+}
+
+func TestTracePublisherResumedTask(t *testing.T) {
+	isolateSettings(t)
+	srv, spans := collector(t)
+	next := publisherFunc(func(context.Context, Event) error { return nil })
+	start := time.Date(2025, 10, 9, 14, 0, 0, 0, time.UTC)
+
+	// Task 1 is blocked, resumed and completed
+	events := []Event{
+		{Type: "task", State: "in_progress", Message: "Deploy", TaskNum: "1", SessionID: "nye"},
+		{Type: "task", State: "blocked", Message: "Needs approval", TaskNum: "1", SessionID: "nye"},
+		{Type: "task", State: "in_progress", Message: "Deploy", TaskNum: "1", SessionID: "nye"},
+		{Type: "task", State: "completed", Message: "Deployed", TaskNum: "1", SessionID: "nye"},
+	}
+	for i, e := range events {
+		e.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		p := NewTracePublisher(next, srv.URL+"/v1/traces")
+		p.OnError = func(err error) { t.Errorf("trace error: %v", err) }
+		if err := p.Publish(context.Background(), e); err != nil {
+			t.Fatalf("Publish(%d) error = %v", i, err)
+		}
+	}
+
+	got := spans()
+	if len(got) != 2 {
+		t.Fatalf("exported %d spans, want 2: %+v", len(got), got)
+	}
+	if got[0].SpanID != TaskSpanID("nye", "1") || got[1].SpanID != TaskSpanID("nye", "1@2") || got[0].SpanID == got[1].SpanID {
+		t.Errorf("span IDs = %s, %s, want two different IDs", got[0].SpanID, got[1].SpanID)
+	}
+	if got[0].Status.Code != otlpStatusUnset || got[1].Status.Code != otlpStatusOK {
+		t.Errorf("span statuses = %d, %d, want unset then OK", got[0].Status.Code, got[1].Status.Code)
+	}
+}
+
+func TestTracePublisherFailures(t *testing.T) {
+	isolateSettings(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	var calls int
+	publishErr := errors.New("nats down")
+	next := publisherFunc(func(context.Context, Event) error {
+		calls++
+		if calls == 1 {
+			return publishErr
+		}
+		return nil
+	})
+	var traceErrs []error
+	p := NewTracePublisher(next, srv.URL)
+	p.OnError = func(err error) { traceErrs = append(traceErrs, err) }
+
+	// A failed publish is returned and not traced
+	event := Event{Type: "session", State: "completed", Message: "Done", SessionID: "s1"}
+	if err := p.Publish(context.Background(), event); !errors.Is(err, publishErr) {
+		t.Errorf("Publish() error = %v, want %v", err, publishErr)
+	}
+	if len(traceErrs) != 0 {
+		t.Errorf("trace errors after failed publish = %v", traceErrs)
+	}
+
+	// A failed export is reported but the publish succeeds
+	if err := p.Publish(context.Background(), event); err != nil {
+		t.Errorf("Publish() error = %v, want nil", err)
+	}
+	if len(traceErrs) != 1 {
+		t.Errorf("trace errors = %v, want one export failure", traceErrs)
+	}
+}